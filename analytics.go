@@ -0,0 +1,22 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+)
+
+// ActiveSince returns the number of unexpired sessions saved at or after t,
+// e.g. the users online in the last five minutes.
+func (m *SQLStore) ActiveSince(ctx context.Context, t time.Time) (int64, error) {
+	return m.countTables(ctx, func(table string) string {
+		return "SELECT COUNT(*) FROM " + table + " WHERE modified >= ? AND expires >= ?" + m.notDeleted()
+	}, m.dbTime(t), m.dbTime(m.clock.Now()))
+}
+
+// CreatedBetween returns the number of sessions created in [from, to),
+// whether or not they have expired since.
+func (m *SQLStore) CreatedBetween(ctx context.Context, from, to time.Time) (int64, error) {
+	return m.countTables(ctx, func(table string) string {
+		return "SELECT COUNT(*) FROM " + table + " WHERE created >= ? AND created < ?" + m.notDeleted()
+	}, m.dbTime(from), m.dbTime(to))
+}
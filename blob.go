@@ -0,0 +1,166 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/admpub/sessions"
+)
+
+// blobMarker prefixes the placeholders left in the payload for values moved
+// to the blob table.
+const blobMarker = "\x00blob\x00"
+
+// spillValues returns a copy of the values of session with those serializing
+// to more than Options.BlobThreshold bytes replaced by placeholders, after
+// storing them in the blob table within tx. Encrypted keys are never
+// spilled. If nothing is or was spilled, the values are returned as they
+// are.
+//
+// Each value is written as soon as it is serialized, so at most one large
+// value is held in memory at a time; database/sql takes it as a whole.
+func (m *SQLStore) spillValues(tx *sql.Tx, session *sessions.Session) (map[interface{}]interface{}, error) {
+	deleteBlobs := m.dialect.rebind("DELETE FROM " + m.blobTable + " WHERE session_id = ?")
+	had, _ := session.Values[m.keyPrefix+"blobs"].(bool)
+	delete(session.Values, m.keyPrefix+"blobs")
+	values := session.Values
+	var spilled bool
+	for k, v := range session.Values {
+		key, ok := k.(string)
+		if !ok || strings.HasPrefix(key, m.keyPrefix) {
+			continue
+		}
+		if _, sealed := m.encKeys[key]; sealed {
+			continue
+		}
+		data, err := m.serializeValue(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= m.blobLimit {
+			continue
+		}
+		if !spilled {
+			if _, err = tx.Exec(deleteBlobs, session.ID); err != nil {
+				return nil, err
+			}
+			values = make(map[interface{}]interface{}, len(session.Values))
+			for k, v := range session.Values {
+				values[k] = v
+			}
+			spilled = true
+		}
+		values[key] = blobMarker + key
+		if _, err = tx.Exec(m.dialect.rebind("INSERT INTO "+m.blobTable+" (session_id, name, data) VALUES (?, ?, ?)"),
+			session.ID, key, data); err != nil {
+			return nil, err
+		}
+	}
+	if had && !spilled {
+		if _, err := tx.Exec(deleteBlobs, session.ID); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// fillBlobs replaces the placeholders left by spillValues in the values of
+// session with the values from the blob table. Values whose blob is missing
+// are dropped.
+func (m *SQLStore) fillBlobs(ctx context.Context, session *sessions.Session) error {
+	var spilled bool
+	for _, v := range session.Values {
+		if s, ok := v.(string); ok && strings.HasPrefix(s, blobMarker) {
+			spilled = true
+			break
+		}
+	}
+	if !spilled {
+		return nil
+	}
+	rows, err := m.query(ctx, "SELECT name, data FROM "+m.blobTable+" WHERE session_id = ?", session.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	// Blobs are decoded row by row, so their raw bytes are not all held at
+	// once.
+	blobs := map[string]interface{}{}
+	for rows.Next() {
+		var name string
+		var data []byte
+		if err = rows.Scan(&name, &data); err != nil {
+			return err
+		}
+		if blobs[name], err = m.deserializeValue(name, data); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for k, v := range session.Values {
+		s, ok := v.(string)
+		if !ok || !strings.HasPrefix(s, blobMarker) {
+			continue
+		}
+		value, ok := blobs[s[len(blobMarker):]]
+		if !ok {
+			delete(session.Values, k)
+			continue
+		}
+		session.Values[k] = value
+	}
+	session.Values[m.keyPrefix+"blobs"] = true
+	return nil
+}
+
+// writePayload calls write with the values of session to serialize into its
+// row. With Options.BlobThreshold, the spilled values and the row are written
+// in one transaction, so a failed save leaves the previous blobs in place:
+// write then gets the statements of st bound to it, and the transaction is
+// retried as a whole on failover.
+func (m *SQLStore) writePayload(ctx context.Context, st *statements, session *sessions.Session, write func(st *statements, values map[interface{}]interface{}) error) error {
+	if m.blobLimit <= 0 {
+		return write(st, session.Values)
+	}
+	had := session.Values[m.keyPrefix+"blobs"]
+	return m.writeRetried(func() error {
+		return m.withTx(ctx, func(tx *sql.Tx) error {
+			if had != nil {
+				session.Values[m.keyPrefix+"blobs"] = had
+			}
+			values, err := m.spillValues(tx, session)
+			if err != nil {
+				return err
+			}
+			return write(st.inTx(tx), values)
+		})
+	})
+}
+
+// removeBlobs removes the blobs of sessionID.
+func (m *SQLStore) removeBlobs(sessionID string) error {
+	_, err := m.exec(context.Background(), "DELETE FROM "+m.blobTable+" WHERE session_id = ?", sessionID)
+	return err
+}
+
+// deleteOrphanBlobs removes the blobs of sessions that no longer exist.
+func (m *SQLStore) deleteOrphanBlobs() error {
+	result, err := m.exec(context.Background(), "DELETE FROM "+m.blobTable+
+		" WHERE NOT EXISTS (SELECT 1 FROM "+m.tableName()+" s WHERE s.id = session_id)")
+	if err != nil {
+		return err
+	}
+	m.countDeleted(result)
+	return nil
+}
+
+// createBlobTable runs Options.BlobDDL.
+func (m *SQLStore) createBlobTable(ddl string) error {
+	query := fmt.Sprintf(ddl, m.blobTable)
+	_, err := m.execRaw(context.Background(), query)
+	return err
+}
@@ -0,0 +1,40 @@
+package sqlstore_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestFailedSaveKeepsSpilledValues(t *testing.T) {
+	// SQLite takes the Postgres column types.
+	s := sqlstoretest.New(t, &sqlstore.Options{BlobThreshold: 64, BlobDDL: sqlstore.PostgresBlobDDL})
+	c := newClient(t, s.SQLStore)
+	big := strings.Repeat(`a`, 256)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	session.Values[`report`] = big
+	c.save(r, session)
+	if _, session = c.get(); session.Values[`report`] != big {
+		t.Fatalf(`loaded report of %d bytes, want the spilled value`, len(session.Values[`report`].(string)))
+	}
+
+	// The row update fails after the new blobs are written.
+	if _, err := s.DB.Exec(`CREATE TRIGGER fail_update BEFORE UPDATE ON session BEGIN SELECT RAISE(ABORT, 'update failed'); END`); err != nil {
+		t.Fatal(err)
+	}
+	r, session = c.get()
+	session.Values[`report`] = strings.Repeat(`b`, 256)
+	if err := c.h.Save(httptest.NewRecorder(), r, session); err == nil {
+		t.Fatal(`Save succeeded despite the failing update`)
+	}
+	if _, err := s.DB.Exec(`DROP TRIGGER fail_update`); err != nil {
+		t.Fatal(err)
+	}
+	if _, session = c.get(); session.Values[`report`] != big {
+		t.Fatalf(`loaded report %.8q... after the failed save, want the previous value`, session.Values[`report`])
+	}
+}
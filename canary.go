@@ -0,0 +1,16 @@
+package sqlstore
+
+import (
+	"math/rand"
+)
+
+// canaryMarker prefixes payloads encoded with Options.CanarySerializer. Gob
+// streams start with a non-zero message length and JSON with '{', so
+// neither begins with it.
+var canaryMarker = []byte("\x00canary\x00")
+
+// useCanary reports whether the next payload is encoded with the canary
+// serializer.
+func (m *SQLStore) useCanary() bool {
+	return m.canary != nil && m.canaryPct > 0 && rand.Intn(100) < m.canaryPct
+}
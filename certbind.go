@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/sessions"
+)
+
+var ErrClientCertMismatch = errors.New("Session bound to another client certificate")
+
+// clientCertFingerprint returns the SHA-256 fingerprint of the client
+// certificate of r, or "" if it presented none.
+func clientCertFingerprint(r requestContext) string {
+	req := r.Request()
+	if req == nil || req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return ``
+	}
+	sum := sha256.Sum256(req.TLS.PeerCertificates[0].Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// bindClientCert records the client certificate of r in a session created
+// by it.
+func (m *SQLStore) bindClientCert(r requestContext, session *sessions.Session) {
+	if _, ok := session.Values[m.keyPrefix+"certFP"]; ok {
+		return
+	}
+	session.Values[m.keyPrefix+"certFP"] = clientCertFingerprint(r)
+}
+
+// checkClientCert verifies that r presents the client certificate session
+// was created with. Sessions created before the binding was enabled are
+// bound on their next save.
+func (m *SQLStore) checkClientCert(r requestContext, session *sessions.Session) error {
+	bound, ok := session.Values[m.keyPrefix+"certFP"].(string)
+	if !ok || bound == clientCertFingerprint(r) {
+		return nil
+	}
+	return ErrClientCertMismatch
+}
@@ -1,13 +1,17 @@
 package sqlstore
 
 import (
-	"log"
-	"strconv"
+	"context"
+	"database/sql"
+	"fmt"
 	"time"
 )
 
 var DefaultInterval = time.Minute * 5
 
+// gcIDBatch bounds the IDs in the IN list of a GC statement.
+const gcIDBatch = 500
+
 // Cleanup runs a background goroutine every interval that deletes expired
 // sessions from the database.
 //
@@ -22,9 +26,14 @@ func (m *SQLStore) Cleanup(interval time.Duration) (chan<- struct{}, <-chan stru
 	return quit, done
 }
 
-// StopCleanup stops the background cleanup from running.
+// StopCleanup stops the background cleanup from running and waits for an
+// in-progress pass to finish. It may be called repeatedly and concurrently
+// with the same channels.
 func (m *SQLStore) StopCleanup(quit chan<- struct{}, done <-chan struct{}) {
-	quit <- struct{}{}
+	select {
+	case quit <- struct{}{}:
+	case <-done:
+	}
 	<-done
 }
 
@@ -32,25 +41,151 @@ func (m *SQLStore) StopCleanup(quit chan<- struct{}, done <-chan struct{}) {
 func (m *SQLStore) cleanup(interval time.Duration, quit <-chan struct{}, done chan<- struct{}) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	// Closing done releases every StopCleanup caller, including late ones.
+	defer close(done)
 
 	for {
 		select {
 		case <-quit:
 			// Handle the quit signal.
-			done <- struct{}{}
 			return
 		case <-ticker.C:
+			if m.readOnly.Load() || (m.gcLeader && !m.isGCLeader()) {
+				continue
+			}
 			// Delete expired sessions on each tick.
-			err := m.deleteExpired()
+			err := m.runCleanup()
+			m.stats.lastGC.Store(m.clock.Now().Unix())
 			if err != nil {
-				log.Printf("sessions: sqlstore: unable to delete expired sessions: %v", err)
+				m.logf(context.Background(), "unable to delete expired sessions: %v", err)
+				m.reportError(OpGC, ``, err)
 			}
 		}
 	}
 }
 
-// deleteExpired deletes expired sessions from the database.
+// deleteExpired deletes expired sessions from the database, along with
+// soft-deleted sessions past their retention window. Resolved tables are only
+// covered while their statements are cached.
 func (m *SQLStore) deleteExpired() error {
-	_, err := m.db.Exec(m.gcMaxAgeSQL + strconv.FormatInt(time.Now().Unix(), 10))
-	return err
+	now := m.clock.Now()
+	// Sessions within the stale grace period can still be revalidated.
+	keep := m.staleGrace
+	if m.keepExpired > keep {
+		keep = m.keepExpired
+	}
+	cutoff := m.stamp(now.Add(-keep))
+	var err error
+	var result sql.Result
+	if m.trackLife && m.reaper == nil {
+		if err = m.observeExpired(cutoff); err != nil {
+			return err
+		}
+	}
+	switch {
+	case m.reaper != nil:
+		err = m.reap(now)
+	case m.dialect == TiDB:
+		// Rows expire through the TTL of the table.
+	case m.procs != nil:
+		result, err = m.execRaw(context.Background(), m.call(m.procs.GC, 1), m.dbStamp(cutoff))
+	case m.onExpired != nil:
+		err = m.deleteExpiredIDs(cutoff)
+	case m.galera && len(m.gcExpired) == 0:
+		err = m.deleteExpiredBatched(cutoff)
+	default:
+		result, err = m.execRaw(context.Background(), m.gcExpiredSQL(m.tableName()), m.dbStamp(cutoff))
+	}
+	if err == nil && result != nil {
+		m.countDeleted(result)
+	}
+	if err == nil && len(m.gcEmpty) > 0 {
+		result, err = m.execRaw(context.Background(), m.dialect.rebind(fmt.Sprintf(m.gcEmpty, m.tableName())),
+			m.dbTime(now.Add(-time.Duration(m.emptyDataAge)*time.Second)))
+		if err == nil {
+			m.countDeleted(result)
+		}
+	}
+	if err == nil && m.emptyCol {
+		err = m.deleteEmpty(m.stamp(now.Add(-time.Duration(m.emptyDataAge) * time.Second)))
+	}
+	if err == nil && m.resolveTable != nil {
+		err = m.deleteExpiredCached(cutoff)
+	}
+	if err == nil && m.blobLimit > 0 {
+		err = m.deleteOrphanBlobs()
+	}
+	if err == nil && len(m.rotation) > 0 {
+		err = m.dropRotated(now)
+	}
+	if err == nil && m.maxRows > 0 {
+		err = m.evictOverQuota()
+	}
+	if err != nil || !m.softDelete {
+		return err
+	}
+	return m.purgeDeleted(now.Add(-m.retention))
+}
+
+// deleteExpiredIDs deletes sessions that expired before cutoff and passes
+// their IDs to the OnExpired hook. Dialects supporting DELETE ... RETURNING
+// do it in one statement; others select the IDs first.
+func (m *SQLStore) deleteExpiredIDs(cutoff int64) error {
+	var query string
+	if m.dialect.returning() {
+		query = m.gcExpiredSQL(m.tableName()) + " RETURNING id"
+	} else {
+		query = m.dialect.rebind("SELECT id FROM " + m.tableName() + " WHERE expires < ?" + m.notDeleted())
+	}
+	rows, err := m.query(context.Background(), query, m.dbStamp(cutoff))
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if !m.dialect.returning() && len(ids) > 0 {
+		// SetExpiry and InvalidateCreatedBefore can expire rows between the
+		// two statements, so only the selected rows are deleted and every
+		// deleted ID is reported.
+		if err = m.deleteIDsExpired(ids, cutoff); err != nil {
+			return err
+		}
+	} else {
+		m.gcDeleted.Add(int64(len(ids)))
+	}
+	if len(ids) > 0 {
+		m.onExpired(ids)
+	}
+	return nil
+}
+
+// deleteIDsExpired deletes the sessions among ids that expired before cutoff,
+// in batches of gcIDBatch.
+func (m *SQLStore) deleteIDsExpired(ids []string, cutoff int64) error {
+	for len(ids) > 0 {
+		n := min(len(ids), gcIDBatch)
+		args := make([]interface{}, 0, n+1)
+		args = append(args, m.dbStamp(cutoff))
+		for _, id := range ids[:n] {
+			args = append(args, id)
+		}
+		result, err := m.exec(context.Background(), "DELETE FROM "+m.tableName()+" WHERE expires < ? AND id IN ("+placeholders(n)+")"+m.notDeleted(), args...)
+		if err != nil {
+			return err
+		}
+		m.countDeleted(result)
+		ids = ids[n:]
+	}
+	return nil
 }
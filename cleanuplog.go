@@ -0,0 +1,76 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// recentCleanups is the number of cleanup runs kept for Stats.
+const recentCleanups = 16
+
+// CleanupRun describes a cleanup pass.
+type CleanupRun struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// Deleted is the number of rows removed, when the database reports it.
+	Deleted int64  `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// cleanupLog is a ring buffer of the most recent cleanup runs.
+type cleanupLog struct {
+	mu   sync.Mutex
+	runs [recentCleanups]CleanupRun
+	next int
+	n    int
+}
+
+func (l *cleanupLog) add(run CleanupRun) {
+	l.mu.Lock()
+	l.runs[l.next] = run
+	l.next = (l.next + 1) % recentCleanups
+	if l.n < recentCleanups {
+		l.n++
+	}
+	l.mu.Unlock()
+}
+
+// list returns the logged runs, oldest first.
+func (l *cleanupLog) list() []CleanupRun {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]CleanupRun, 0, l.n)
+	for i := l.n; i > 0; i-- {
+		list = append(list, l.runs[(l.next-i+recentCleanups)%recentCleanups])
+	}
+	return list
+}
+
+// runCleanup runs deleteExpired and records the run.
+func (m *SQLStore) runCleanup() error {
+	start := m.clock.Now()
+	m.gcDeleted.Store(0)
+	err := m.deleteExpired()
+	run := CleanupRun{
+		Start:    start,
+		Duration: m.clock.Now().Sub(start),
+		Deleted:  m.gcDeleted.Load(),
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	m.cleanups.add(run)
+	m.checkMassDelete(OpGC, run.Deleted)
+	if m.onCleanup != nil {
+		m.onCleanup(run)
+	}
+	return err
+}
+
+// countDeleted adds the rows affected by a GC statement to the current run.
+func (m *SQLStore) countDeleted(result sql.Result) {
+	if n, err := result.RowsAffected(); err == nil {
+		m.gcDeleted.Add(n)
+	}
+}
@@ -0,0 +1,62 @@
+package sqlstore_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/admpub/sessions"
+	sqlstore "github.com/coscms/session-sqlstore"
+)
+
+// client drives an HTTPStore like a browser: every request carries the
+// cookies of the last saved response.
+type client struct {
+	t       *testing.T
+	h       *sqlstore.HTTPStore
+	ctx     context.Context
+	cookies []*http.Cookie
+}
+
+func newClient(t *testing.T, store *sqlstore.SQLStore) *client {
+	return &client{t: t, h: sqlstore.NewHTTPStore(store, nil), ctx: context.Background()}
+}
+
+// clone returns a client holding the same cookies, like a second tab.
+func (c *client) clone() *client {
+	cc := *c
+	return &cc
+}
+
+// request returns a request carrying the cookies of c.
+func (c *client) request() *http.Request {
+	r := httptest.NewRequest(http.MethodGet, `/`, nil).WithContext(c.ctx)
+	for _, cookie := range c.cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+// get loads the session named SID.
+func (c *client) get() (*http.Request, *sessions.Session) {
+	c.t.Helper()
+	r := c.request()
+	session, err := c.h.Get(r, `SID`)
+	if err != nil {
+		c.t.Fatalf(`Get: %v`, err)
+	}
+	return r, session
+}
+
+// save saves session and keeps the cookies of the response.
+func (c *client) save(r *http.Request, session *sessions.Session) {
+	c.t.Helper()
+	w := httptest.NewRecorder()
+	if err := c.h.Save(w, r, session); err != nil {
+		c.t.Fatalf(`Save: %v`, err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) > 0 {
+		c.cookies = cookies
+	}
+}
@@ -0,0 +1,19 @@
+package sqlstore
+
+import "time"
+
+// Clock tells the store the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts an ordinary function to the Clock interface.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the default Clock, backed by time.Now.
+var SystemClock Clock = ClockFunc(time.Now)
@@ -0,0 +1,78 @@
+// Command sessionctl runs maintenance tasks on a session table.
+//
+//	sessionctl scan -dsn 'user:pass@tcp(127.0.0.1:3306)/test' -action quarantine -quarantine session_bad
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: sessionctl scan [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case `scan`:
+		scan(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+// scan reports, and optionally deletes or quarantines, the rows that cannot
+// be decoded.
+func scan(args []string) {
+	fs := flag.NewFlagSet(`scan`, flag.ExitOnError)
+	driver := fs.String(`driver`, `mysql`, `database/sql driver name`)
+	dsn := fs.String(`dsn`, ``, `data source name`)
+	table := fs.String(`table`, `session`, `session table`)
+	jsonPayload := fs.Bool(`json`, false, `payloads are encoded with the JSON serializer instead of gob`)
+	base64 := fs.Bool(`base64`, false, `payloads are stored base64-encoded`)
+	checksum := fs.Bool(`checksum`, false, `verify the checksum column`)
+	action := fs.String(`action`, sqlstore.ScanReport, `what to do with corrupt rows: "", delete or quarantine`)
+	quarantine := fs.String(`quarantine`, ``, `table receiving corrupt rows with -action quarantine`)
+	batch := fs.Int(`batch`, 0, `rows read per query`)
+	fs.Parse(args)
+	if len(*dsn) == 0 {
+		log.Fatal(`sessionctl: -dsn is required`)
+	}
+	cfg := &sqlstore.Options{
+		Table:    *table,
+		Base64:   *base64,
+		Checksum: *checksum,
+	}
+	if *jsonPayload {
+		cfg.Serializer = sqlstore.JSONSerializer{}
+	}
+	store, err := sqlstore.NewWithDSN(*driver, *dsn, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	result, err := store.Scan(context.Background(), sqlstore.ScanOptions{
+		Action:          *action,
+		QuarantineTable: *quarantine,
+		BatchSize:       *batch,
+	})
+	if result != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent(``, `  `)
+		enc.Encode(result)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,241 @@
+package sqlstore
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/gob"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/admpub/securecookie"
+)
+
+// maxPooledBuffer is the largest buffer kept for reuse, so that an occasional
+// huge session does not pin its memory in the pool.
+const maxPooledBuffer = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// StreamSerializer is implemented by serializers that write to and read from
+// a stream. The store then encodes payloads straight into the value of the
+// data column, and decodes them straight from it, without holding the
+// serialized payload as a separate slice. JSONSerializer implements it.
+type StreamSerializer interface {
+	SerializeTo(w io.Writer, src interface{}) error
+	DeserializeFrom(r io.Reader, dst interface{}) error
+}
+
+// payloadWriter passes the serialized payload on to w, keeping its length
+// and checksum.
+type payloadWriter struct {
+	w   io.Writer
+	n   int
+	crc uint32
+}
+
+func (p *payloadWriter) Write(b []byte) (int, error) {
+	p.n += len(b)
+	p.crc = crc32.Update(p.crc, crc32.IEEETable, b)
+	return p.w.Write(b)
+}
+
+// payloadReader is the counterpart of payloadWriter for loads.
+type payloadReader struct {
+	r   io.Reader
+	crc uint32
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.crc = crc32.Update(p.crc, crc32.IEEETable, b[:n])
+	return n, err
+}
+
+// serialize writes values to w with ser, streaming if it can.
+func serialize(ser securecookie.Serializer, w io.Writer, values map[interface{}]interface{}) error {
+	if s, ok := ser.(StreamSerializer); ok {
+		return s.SerializeTo(w, values)
+	}
+	encoded, err := ser.Serialize(values)
+	if err == nil {
+		_, err = w.Write(encoded)
+	}
+	return err
+}
+
+// deserialize is the inverse of serialize.
+func deserialize(ser securecookie.Serializer, r io.Reader, values *map[interface{}]interface{}) error {
+	if s, ok := ser.(StreamSerializer); ok {
+		return s.DeserializeFrom(r, values)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return ser.Deserialize(data, values)
+}
+
+// writeValues serializes values to w.
+func (m *SQLStore) writeValues(w io.Writer, values map[interface{}]interface{}) (err error) {
+	if len(m.encKeys) > 0 {
+		if values, err = m.sealValues(values); err != nil {
+			return err
+		}
+	}
+	if m.useCanary() {
+		if _, err = w.Write(canaryMarker); err != nil {
+			return err
+		}
+		return serialize(m.canary, w, values)
+	}
+	if m.serializer != nil {
+		return serialize(m.serializer, w, values)
+	}
+	return gob.NewEncoder(w).Encode(values)
+}
+
+// readValues decodes a payload read from r into values.
+func (m *SQLStore) readValues(r io.Reader, values *map[interface{}]interface{}) error {
+	err := m.deserializeValues(r, values)
+	if err != nil || len(m.encKeys) == 0 {
+		return err
+	}
+	return m.openValues(*values)
+}
+
+// deserializeValues decodes values with the serializer the payload read
+// from r was written with.
+func (m *SQLStore) deserializeValues(r io.Reader, values *map[interface{}]interface{}) error {
+	if m.canary != nil {
+		br := bufio.NewReader(r)
+		if prefix, _ := br.Peek(len(canaryMarker)); bytes.Equal(prefix, canaryMarker) {
+			br.Discard(len(canaryMarker))
+			return deserialize(m.canary, br, values)
+		}
+		r = br
+	}
+	if m.serializer != nil {
+		return deserialize(m.serializer, r, values)
+	}
+	return gob.NewDecoder(r).Decode(values)
+}
+
+// pooledBuffer returns an empty buffer from bufferPool and the func putting
+// it back.
+func pooledBuffer() (*bytes.Buffer, func()) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf, func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}
+}
+
+// encodeValues serializes values into a pooled buffer, for payloads stored
+// outside the data column. The returned bytes are only valid until release
+// is called.
+func (m *SQLStore) encodeValues(values map[interface{}]interface{}) (encoded []byte, release func(), err error) {
+	buf, release := pooledBuffer()
+	if err = m.writeValues(buf, values); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return buf.Bytes(), release, nil
+}
+
+// decodeValues decodes a payload encoded by encodeValues.
+func (m *SQLStore) decodeValues(data []byte, values *map[interface{}]interface{}) error {
+	return m.readValues(bytes.NewReader(data), values)
+}
+
+// column is a payload encoded into the value of the data column.
+type column struct {
+	// value is the argument written to the data column.
+	value interface{}
+	// size is the length of the serialized payload.
+	size int
+	// checksum is the CRC-32 of the serialized payload.
+	checksum int64
+	release  func()
+}
+
+// encodeColumn serializes values into the value of the data column. The
+// payload streams from the serializer through the checksum and the base64
+// encoder straight into one pooled buffer, which the value refers to until
+// release is called.
+func (m *SQLStore) encodeColumn(values map[interface{}]interface{}) (*column, error) {
+	buf, release := pooledBuffer()
+	pw := &payloadWriter{w: buf}
+	var enc io.WriteCloser
+	if m.base64 {
+		enc = base64.NewEncoder(base64.StdEncoding, buf)
+		pw.w = enc
+	}
+	err := m.writeValues(pw, values)
+	if err == nil && enc != nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	c := &column{size: pw.n, checksum: int64(pw.crc), release: release}
+	if m.base64 || m.jsonColumn {
+		c.value = buf.String()
+	} else {
+		c.value = buf.Bytes()
+	}
+	return c, nil
+}
+
+// decodeColumn decodes the content of the data column into values, reading
+// the payload straight from data. With Options.Checksum it verifies a valid
+// checksum against the payload and returns ErrCorruptSession on a mismatch.
+func (m *SQLStore) decodeColumn(data []byte, checksum sql.NullInt64, values *map[interface{}]interface{}) error {
+	r := io.Reader(bytes.NewReader(data))
+	if m.base64 {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+	pr := &payloadReader{r: r}
+	err := m.readValues(pr, values)
+	if !m.checksum || !checksum.Valid {
+		return err
+	}
+	// The decoder may stop short of the end of a corrupt payload.
+	if _, copyErr := io.Copy(io.Discard, pr); copyErr != nil || int64(pr.crc) != checksum.Int64 {
+		return ErrCorruptSession
+	}
+	return err
+}
+
+// EncodeData serializes values into the content of the data column, as the
+// store writes it, for tools and test fixtures writing rows directly.
+func (m *SQLStore) EncodeData(values map[interface{}]interface{}) (interface{}, error) {
+	c, err := m.encodeColumn(values)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release()
+	if data, ok := c.value.([]byte); ok {
+		return append([]byte(nil), data...), nil
+	}
+	return c.value, nil
+}
+
+// DecodeData is the inverse of EncodeData.
+func (m *SQLStore) DecodeData(data []byte) (map[interface{}]interface{}, error) {
+	values := map[interface{}]interface{}{}
+	if len(data) == 0 {
+		return values, nil
+	}
+	err := m.decodeColumn(data, sql.NullInt64{}, &values)
+	return values, err
+}
@@ -0,0 +1,93 @@
+package sqlstore_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/admpub/securecookie"
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+// checksumDDL is sqlstoretest.DDL with the column of Options.Checksum.
+const checksumDDL = "CREATE TABLE IF NOT EXISTS %s (" +
+	"id VARCHAR(100) NOT NULL PRIMARY KEY, " +
+	"data BLOB, " +
+	"created INTEGER NOT NULL DEFAULT 0, " +
+	"modified INTEGER NOT NULL DEFAULT 0, " +
+	"expires INTEGER NOT NULL DEFAULT 0, " +
+	"deleted_at INTEGER, " +
+	"checksum INTEGER)"
+
+func TestStreamedPayloadsRoundTrip(t *testing.T) {
+	for name, cfg := range map[string]*sqlstore.Options{
+		`gob`:         {},
+		`base64`:      {Base64: true},
+		`json`:        {Serializer: sqlstore.JSONSerializer{}},
+		`json base64`: {Serializer: sqlstore.JSONSerializer{}, Base64: true},
+		`canary`:      {Base64: true, CanarySerializer: sqlstore.JSONSerializer{}, CanaryPercent: 100},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := sqlstoretest.New(t, cfg)
+			c := newClient(t, s.SQLStore)
+			r, session := c.get()
+			session.Values[`user`] = `alice`
+			c.save(r, session)
+			if _, session = c.get(); session.Values[`user`] != `alice` {
+				t.Fatalf(`loaded %v, want user alice`, session.Values)
+			}
+
+			data, err := s.EncodeData(map[interface{}]interface{}{`user`: `bob`})
+			if err != nil {
+				t.Fatalf(`EncodeData: %v`, err)
+			}
+			raw, ok := data.([]byte)
+			if !ok {
+				raw = []byte(data.(string))
+			}
+			values, err := s.DecodeData(raw)
+			if err != nil || values[`user`] != `bob` {
+				t.Fatalf(`DecodeData = %v, %v, want user bob`, values, err)
+			}
+		})
+	}
+}
+
+func TestChecksumRejectsCorruptStreamedPayload(t *testing.T) {
+	db, err := sql.Open(`sqlite3`, `file:codecchecksum?mode=memory&cache=shared`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	cfg := &sqlstore.Options{Dialect: sqlstore.SQLite, Checksum: true, Base64: true,
+		KeyPairs: [][]byte{securecookie.GenerateRandomKey(32)}}
+	cfg.SetDDL(checksumDDL)
+	s, err := sqlstore.New(db, cfg)
+	if err != nil {
+		t.Fatalf(`New: %v`, err)
+	}
+	defer s.Close()
+	c := newClient(t, s)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if _, session = c.get(); session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v, want user alice`, session.Values)
+	}
+
+	// Flip one payload character so that the values still decode.
+	var data string
+	if err = db.QueryRow(`SELECT data FROM session WHERE id = ?`, session.ID).Scan(&data); err != nil {
+		t.Fatal(err)
+	}
+	tampered := []byte(data)
+	tampered[len(tampered)-6] ^= 1
+	if _, err = db.Exec(`UPDATE session SET data = ? WHERE id = ?`, string(tampered), session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.h.Get(c.request(), `SID`); !errors.Is(err, sqlstore.ErrCorruptSession) {
+		t.Fatalf(`Get of a tampered row: err %v, want ErrCorruptSession`, err)
+	}
+}
@@ -0,0 +1,121 @@
+package sqlstore
+
+import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/admpub/errors"
+)
+
+// configField is an Options field that can be set from the environment or a
+// DSN.
+type configField struct {
+	name string // query parameter, the JSON name of the field
+	env  string // environment variable suffix
+	set  func(o *Options, value string) error
+}
+
+var configFields = []configField{
+	{`table`, `TABLE`, func(o *Options, v string) error {
+		o.Table = v
+		return nil
+	}},
+	{`keyPrefix`, `KEY_PREFIX`, func(o *Options, v string) error {
+		o.KeyPrefix = v
+		return nil
+	}},
+	{`keyPairs`, `KEY_PAIRS`, func(o *Options, v string) (err error) {
+		o.KeyPairs, err = parseKeyPairs(v)
+		return
+	}},
+	{`maxAge`, `MAX_AGE`, func(o *Options, v string) (err error) {
+		o.MaxAge, err = strconv.Atoi(v)
+		return
+	}},
+	{`emptyDataAge`, `EMPTY_DATA_AGE`, func(o *Options, v string) (err error) {
+		o.EmptyDataAge, err = strconv.Atoi(v)
+		return
+	}},
+	{`maxLength`, `MAX_LENGTH`, func(o *Options, v string) (err error) {
+		o.MaxLength, err = strconv.Atoi(v)
+		return
+	}},
+	{`checkInterval`, `CHECK_INTERVAL`, func(o *Options, v string) (err error) {
+		o.CheckInterval, err = time.ParseDuration(v)
+		return
+	}},
+	{`maxReconnect`, `MAX_RECONNECT`, func(o *Options, v string) (err error) {
+		o.MaxReconnect, err = strconv.Atoi(v)
+		return
+	}},
+}
+
+// OptionsFromEnv reads Options from environment variables named prefix
+// followed by TABLE, KEY_PREFIX, KEY_PAIRS, MAX_AGE, EMPTY_DATA_AGE,
+// MAX_LENGTH, CHECK_INTERVAL and MAX_RECONNECT, e.g. SESSION_MAX_AGE=3600
+// for the prefix "SESSION_". Unset variables leave the field at its zero
+// value. KEY_PAIRS is a comma-separated list of base64 keys, standard or
+// URL-safe, and CHECK_INTERVAL a time.Duration such as "5m".
+func OptionsFromEnv(prefix string) (*Options, error) {
+	return optionsFrom(func(f configField) (string, bool) {
+		return os.LookupEnv(prefix + f.env)
+	})
+}
+
+// OptionsFromDSN reads Options from the query of a URL-style config string
+// whose parameters are named after the JSON fields of Options, e.g.
+//
+//	sqlstore://?table=session&maxAge=3600&checkInterval=5m&keyPairs=base64key
+func OptionsFromDSN(dsn string) (*Options, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	return optionsFrom(func(f configField) (string, bool) {
+		v, ok := query[f.name]
+		if !ok || len(v) == 0 {
+			return ``, false
+		}
+		return v[0], true
+	})
+}
+
+func optionsFrom(lookup func(f configField) (string, bool)) (*Options, error) {
+	o := &Options{}
+	for _, f := range configFields {
+		value, ok := lookup(f)
+		if !ok {
+			continue
+		}
+		if err := f.set(o, value); err != nil {
+			return nil, errors.Wrapf(err, "sqlstore: invalid %s", f.name)
+		}
+	}
+	return o, nil
+}
+
+// parseKeyPairs decodes a comma-separated list of standard or URL-safe
+// base64 keys.
+func parseKeyPairs(value string) ([][]byte, error) {
+	var keys [][]byte
+	for _, part := range strings.Split(value, `,`) {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			// URL-safe keys survive query strings without escaping.
+			if key, err = base64.URLEncoding.DecodeString(part); err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/sessions"
+)
+
+var ErrNoCookieHash = errors.New("sqlstore: Options.CookieHashColumn is not set")
+
+// CookieHash returns the hash of an encoded session cookie value stored in
+// the `cookie_hash` column: the hex SHA-256 of the value.
+func CookieHash(cookieValue string) string {
+	sum := sha256.Sum256([]byte(cookieValue))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindByCookie returns the ID of the session whose latest cookie is
+// cookieValue, as copied from a browser, without decoding it. It requires
+// Options.CookieHashColumn and fails with sql.ErrNoRows if there is no such
+// session.
+func (m *SQLStore) FindByCookie(ctx context.Context, cookieValue string) (string, error) {
+	if !m.cookieHash {
+		return ``, ErrNoCookieHash
+	}
+	var id string
+	err := m.scanFirst(ctx, func(table string) string {
+		return "SELECT id FROM " + table + " WHERE cookie_hash = ?" + m.notDeleted()
+	}, []interface{}{CookieHash(cookieValue)}, &id)
+	return id, err
+}
+
+// popCookieHash removes the hash of the cookie being issued from the values
+// of session, to be stored in the `cookie_hash` column instead.
+func (m *SQLStore) popCookieHash(session *sessions.Session) string {
+	hash, _ := session.Values[m.keyPrefix+"cookieHash"].(string)
+	delete(session.Values, m.keyPrefix+"cookieHash")
+	return hash
+}
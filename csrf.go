@@ -0,0 +1,98 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/securecookie"
+	"github.com/admpub/sessions"
+)
+
+var ErrNoCSRFColumn = errors.New("sqlstore: Options.CSRFColumn is not set")
+
+// csrfNonceLen is the length of the random nonce masking each token.
+const csrfNonceLen = 16
+
+// CSRFToken returns a CSRF token bound to session, creating its secret on
+// first use. Every call returns a different token, all valid until the
+// secret is rotated with RotateCSRF. A new secret of a saved session is
+// stored in the `csrf_secret` column right away.
+func (m *SQLStore) CSRFToken(ctx context.Context, session *sessions.Session) (string, error) {
+	if !m.csrfCol {
+		return ``, ErrNoCSRFColumn
+	}
+	secret, _ := session.Values[m.keyPrefix+"csrfSecret"].(string)
+	if len(secret) == 0 {
+		var err error
+		if secret, err = m.setCSRFSecret(ctx, session); err != nil {
+			return ``, err
+		}
+	}
+	nonce := securecookie.GenerateRandomKey(csrfNonceLen)
+	if nonce == nil {
+		return ``, errors.New("sqlstore: unable to generate a CSRF token")
+	}
+	return base64.RawURLEncoding.EncodeToString(append(nonce, csrfMAC(secret, nonce)...)), nil
+}
+
+// ValidateCSRF reports whether token was issued by CSRFToken for the
+// current secret of session.
+func (m *SQLStore) ValidateCSRF(session *sessions.Session, token string) bool {
+	secret, _ := session.Values[m.keyPrefix+"csrfSecret"].(string)
+	if len(secret) == 0 {
+		return false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != csrfNonceLen+sha256.Size {
+		return false
+	}
+	return hmac.Equal(raw[csrfNonceLen:], csrfMAC(secret, raw[:csrfNonceLen]))
+}
+
+// RotateCSRF replaces the CSRF secret of session, invalidating every token
+// issued so far. Apps should call it when the user signs in or out.
+func (m *SQLStore) RotateCSRF(ctx context.Context, session *sessions.Session) error {
+	if !m.csrfCol {
+		return ErrNoCSRFColumn
+	}
+	_, err := m.setCSRFSecret(ctx, session)
+	return err
+}
+
+// setCSRFSecret generates a new CSRF secret for session and, if the
+// session is saved, stores it.
+func (m *SQLStore) setCSRFSecret(ctx context.Context, session *sessions.Session) (string, error) {
+	key := securecookie.GenerateRandomKey(32)
+	if key == nil {
+		return ``, errors.New("sqlstore: unable to generate a CSRF secret")
+	}
+	secret := base64.RawURLEncoding.EncodeToString(key)
+	session.Values[m.keyPrefix+"csrfSecret"] = secret
+	if session.IsNew || len(session.ID) == 0 {
+		return secret, nil
+	}
+	st, err := m.acquire(ctx)
+	if err != nil {
+		return ``, err
+	}
+	defer m.release(st)
+	_, err = m.exec(ctx, "UPDATE "+st.table+" SET csrf_secret = ? WHERE id = ?", secret, session.ID)
+	return secret, err
+}
+
+// popCSRF removes the CSRF secret of session from its values, to be stored
+// in the `csrf_secret` column instead.
+func (m *SQLStore) popCSRF(session *sessions.Session) string {
+	secret, _ := session.Values[m.keyPrefix+"csrfSecret"].(string)
+	delete(session.Values, m.keyPrefix+"csrfSecret")
+	return secret
+}
+
+func csrfMAC(secret string, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,83 @@
+package sqlstore
+
+// DDL for the session table. %s is replaced with the quoted table name; pass
+// one of these to Options.SetDDL or adapt it to your needs.
+const (
+	MySQLDDL = "CREATE TABLE IF NOT EXISTS %s (" +
+		"`id` varchar(100) NOT NULL, " +
+		"`data` mediumblob, " +
+		"`created` int unsigned NOT NULL DEFAULT 0, " +
+		"`modified` int unsigned NOT NULL DEFAULT 0, " +
+		"`expires` int unsigned NOT NULL DEFAULT 0, " +
+		"PRIMARY KEY (`id`), KEY `expires` (`expires`)" +
+		") ENGINE=InnoDB"
+
+	// MySQLJSONDDL stores the payload in a JSON column (MySQL 5.7+) for use
+	// with JSONSerializer and Options.JSONColumn. Fields can be extracted
+	// into indexed generated columns, e.g.
+	//
+	//	ALTER TABLE session
+	//	  ADD COLUMN user_id BIGINT AS (data->>'$.user_id') STORED,
+	//	  ADD INDEX user_id (user_id);
+	MySQLJSONDDL = "CREATE TABLE IF NOT EXISTS %s (" +
+		"`id` varchar(100) NOT NULL, " +
+		"`data` json, " +
+		"`created` int unsigned NOT NULL DEFAULT 0, " +
+		"`modified` int unsigned NOT NULL DEFAULT 0, " +
+		"`expires` int unsigned NOT NULL DEFAULT 0, " +
+		"PRIMARY KEY (`id`), KEY `expires` (`expires`)" +
+		") ENGINE=InnoDB"
+
+	// PostgresJSONBDDL stores the payload as JSONB for use with
+	// JSONSerializer and Options.JSONColumn, e.g.
+	//
+	//	SELECT count(*) FROM session WHERE data->>'user_id' = '42';
+	//	CREATE INDEX session_data ON session USING GIN (data);
+	PostgresJSONBDDL = `CREATE TABLE IF NOT EXISTS %s (` +
+		`id varchar(100) NOT NULL PRIMARY KEY, ` +
+		`data jsonb, ` +
+		`created bigint NOT NULL DEFAULT 0, ` +
+		`modified bigint NOT NULL DEFAULT 0, ` +
+		`expires bigint NOT NULL DEFAULT 0)`
+
+	// TiDBTTLDDL lets TiDB (6.5+) expire rows itself through the TTL of the
+	// `expires_at` column, which the store writes when Options.Dialect is
+	// TiDB; GC then skips its DELETE. `expires_at` is passed as a time
+	// value, so the connection time zone must match the location the driver
+	// formats times in, e.g. loc=UTC with time_zone='+00:00'.
+	TiDBTTLDDL = "CREATE TABLE IF NOT EXISTS %s (" +
+		"`id` varchar(100) NOT NULL, " +
+		"`data` mediumblob, " +
+		"`created` int unsigned NOT NULL DEFAULT 0, " +
+		"`modified` int unsigned NOT NULL DEFAULT 0, " +
+		"`expires` int unsigned NOT NULL DEFAULT 0, " +
+		"`expires_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, " +
+		"PRIMARY KEY (`id`), KEY `expires` (`expires`)" +
+		") TTL = `expires_at` + INTERVAL 0 DAY TTL_JOB_INTERVAL = '5m'"
+
+	// MySQLBlobDDL creates the side table of Options.BlobThreshold.
+	MySQLBlobDDL = "CREATE TABLE IF NOT EXISTS %s (" +
+		"`session_id` varchar(100) NOT NULL, " +
+		"`name` varchar(191) NOT NULL, " +
+		"`data` longblob, " +
+		"PRIMARY KEY (`session_id`, `name`)" +
+		") ENGINE=InnoDB"
+
+	// PostgresBlobDDL is MySQLBlobDDL for Postgres.
+	PostgresBlobDDL = `CREATE TABLE IF NOT EXISTS %s (` +
+		`session_id varchar(100) NOT NULL, ` +
+		`name varchar(191) NOT NULL, ` +
+		`data bytea, ` +
+		`PRIMARY KEY (session_id, name))`
+
+	// VitessVSchema shards the session table of a Vitess keyspace by id,
+	// for use with MySQLDDL and Options.ProxyMode. Replace "session" with
+	// Options.Table. GC and the statistics helpers scatter to all shards.
+	VitessVSchema = `{
+  "sharded": true,
+  "vindexes": {"xxhash": {"type": "xxhash"}},
+  "tables": {
+    "session": {"column_vindexes": [{"column": "id", "name": "xxhash"}]}
+  }
+}`
+)
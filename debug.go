@@ -0,0 +1,120 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recentErrors is the number of errors kept for DebugInfo.
+const recentErrors = 16
+
+// ErrorEntry is an error reported by the store. Session IDs are left out, as
+// they are credentials.
+type ErrorEntry struct {
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`
+	Error string    `json:"error"`
+	// TraceID is the trace ID of the request that raised the error, see
+	// Options.TraceID.
+	TraceID string `json:"traceID,omitempty"`
+}
+
+// errorLog is a ring buffer of the most recent errors.
+type errorLog struct {
+	mu      sync.Mutex
+	entries [recentErrors]ErrorEntry
+	next    int
+	n       int
+}
+
+func (l *errorLog) add(e ErrorEntry) {
+	l.mu.Lock()
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % recentErrors
+	if l.n < recentErrors {
+		l.n++
+	}
+	l.mu.Unlock()
+}
+
+// list returns the logged errors, oldest first.
+func (l *errorLog) list() []ErrorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]ErrorEntry, 0, l.n)
+	for i := l.n; i > 0; i-- {
+		list = append(list, l.entries[(l.next-i+recentErrors)%recentErrors])
+	}
+	return list
+}
+
+// DebugInfo is a snapshot of the store internals for production triage.
+type DebugInfo struct {
+	// Options the store was created with. Keys and hooks are left out.
+	Options  Options `json:"options"`
+	ReadOnly bool    `json:"readOnly"`
+	Closed   bool    `json:"closed"`
+	// CachedTables are the resolved tables with prepared statements.
+	CachedTables []string    `json:"cachedTables"`
+	DB           sql.DBStats `json:"db"`
+	// CleanupInterval is zero if no cleanup is scheduled.
+	CleanupInterval time.Duration `json:"cleanupInterval"`
+	LastCleanup     time.Time     `json:"lastCleanup"`
+	Stats           Stats         `json:"stats"`
+	RecentErrors    []ErrorEntry  `json:"recentErrors"`
+}
+
+// DebugInfo returns a snapshot of the store internals.
+func (m *SQLStore) DebugInfo() DebugInfo {
+	info := DebugInfo{
+		Options:      m.options,
+		ReadOnly:     m.readOnly.Load(),
+		Closed:       m.closed.Load(),
+		DB:           m.db.Stats(),
+		Stats:        m.Stats(),
+		RecentErrors: m.errLog.list(),
+	}
+	m.mu.Lock()
+	if m.doneC != nil {
+		info.CleanupInterval = m.checkInterval
+		if info.CleanupInterval <= 0 {
+			info.CleanupInterval = DefaultInterval
+		}
+	}
+	m.mu.Unlock()
+	if ts := m.stats.lastGC.Load(); ts > 0 {
+		info.LastCleanup = time.Unix(ts, 0)
+	}
+	c := &m.stmtCache
+	c.mu.Lock()
+	for name := range c.entries {
+		info.CachedTables = append(info.CachedTables, name)
+	}
+	c.mu.Unlock()
+	sort.Strings(info.CachedTables)
+	return info
+}
+
+// DebugHandler returns an HTTP handler serving DebugInfo as JSON. Mount it
+// on an internal address only.
+func (m *SQLStore) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json; charset=utf-8`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent(``, `  `)
+		enc.Encode(m.DebugInfo())
+	})
+}
+
+// PublishExpvar publishes DebugInfo as the expvar name, so it is served by
+// /debug/vars. Like expvar.Publish, it panics if name is already in use.
+func (m *SQLStore) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.DebugInfo()
+	}))
+}
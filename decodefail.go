@@ -0,0 +1,64 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/admpub/securecookie"
+)
+
+// Categories of cookie decode failures, see Stats.DecodeFailures.
+const (
+	// DecodeBadSignature: no configured key verifies the cookie. A spike
+	// usually means the keys were changed without keeping the old ones, or
+	// forged cookies.
+	DecodeBadSignature = `bad_signature`
+	// DecodeExpired: the signature is valid but the codec timestamp is
+	// expired or in the future.
+	DecodeExpired = `expired`
+	// DecodeRetiredKey: the cookie is tagged with a key generation that is
+	// no longer configured, see Options.KeyGeneration.
+	DecodeRetiredKey = `retired_key`
+	// DecodeMalformed: any other failure, such as invalid base64.
+	DecodeMalformed = `malformed`
+)
+
+var decodeCategories = [...]string{DecodeBadSignature, DecodeExpired, DecodeRetiredKey, DecodeMalformed}
+
+// decodeCategory returns the index in decodeCategories of the category of
+// err.
+func decodeCategory(err error) int {
+	if err == ErrRetiredKey {
+		return 2
+	}
+	errs, ok := err.(securecookie.MultiError)
+	if !ok {
+		errs = securecookie.MultiError{err}
+	}
+	badMAC := len(errs) > 0
+	for _, e := range errs {
+		// Timestamps are only checked once the MAC is verified.
+		if strings.Contains(e.Error(), "timestamp") {
+			return 1
+		}
+		if e != securecookie.ErrMacInvalid {
+			badMAC = false
+		}
+	}
+	if badMAC {
+		return 0
+	}
+	return 3
+}
+
+// observeDecodeFailure counts a cookie decode failure by category, reports
+// it and passes it to Options.OnDecodeFailure.
+func (m *SQLStore) observeDecodeFailure(ctx context.Context, err error) {
+	i := decodeCategory(err)
+	m.stats.decodeFails[i].Add(1)
+	err = m.traced(ctx, err)
+	m.reportError(OpDecode, ``, err)
+	if m.onDecodeFail != nil {
+		m.onDecodeFail(decodeCategories[i], err)
+	}
+}
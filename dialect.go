@@ -0,0 +1,124 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the SQL flavor spoken by the session database.
+type Dialect string
+
+const (
+	MySQL    Dialect = `mysql`
+	MariaDB  Dialect = `mariadb`
+	SQLite   Dialect = `sqlite`
+	Postgres Dialect = `postgres`
+	TiDB     Dialect = `tidb`
+)
+
+// Quote encloses an identifier, stripping quotes it is already enclosed in.
+func (d Dialect) Quote(ident string) string {
+	if d == Postgres {
+		return `"` + strings.Trim(ident, `"`) + `"`
+	}
+	return "`" + strings.Trim(ident, "`") + "`"
+}
+
+// rebind rewrites the ? placeholders of query into the dialect's bind
+// parameter syntax.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres || strings.IndexByte(query, '?') < 0 {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// returning reports whether DELETE ... RETURNING is supported.
+func (d Dialect) returning() bool {
+	return d == Postgres || d == MariaDB || d == SQLite
+}
+
+// upsert returns a statement that inserts a row with cols or, if a row with
+// the same id exists, updates it in place, keeping any columns not in cols.
+// The created time is kept as well, unless the row is revived: it expired
+// or, with softDeleted, it is marked deleted. extra assignments are added
+// to the update.
+func (d Dialect) upsert(table string, cols []string, softDeleted bool, extra ...string) string {
+	insert := "INSERT INTO " + table + "(" + strings.Join(cols, ", ") + ") VALUES (" + placeholders(len(cols)) + ")"
+	value := func(col string) string {
+		if d == Postgres || d == SQLite {
+			return "EXCLUDED." + col
+		}
+		return "VALUES(" + col + ")"
+	}
+	sets := make([]string, 0, len(cols)+len(extra))
+	for _, col := range cols {
+		switch col {
+		case `id`:
+		case `created`:
+			// First, as MySQL assigns in order: later conditions would see
+			// the new expires and deleted_at.
+			revived := table + ".expires < " + value("modified")
+			if softDeleted {
+				revived = table + ".deleted_at IS NOT NULL OR " + revived
+			}
+			sets = append([]string{"created = CASE WHEN " + revived + " THEN " + value("created") + " ELSE " + table + ".created END"}, sets...)
+		default:
+			sets = append(sets, col+" = "+value(col))
+		}
+	}
+	sets = append(sets, extra...)
+	if d == Postgres || d == SQLite {
+		return insert + " ON CONFLICT (id) DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+	return insert + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// exec runs a statement written with ? placeholders.
+func (m *SQLStore) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return m.execRaw(ctx, m.dialect.rebind(query), args...)
+}
+
+// execRaw runs a statement as it is written, such as DDL.
+func (m *SQLStore) execRaw(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	m.ops.acquire()
+	defer m.ops.release()
+	return m.db.ExecContext(ctx, query, args...)
+}
+
+// queryRow runs a single-row query written with ? placeholders. The slot of
+// Options.MaxConcurrentOps is held until the row is scanned.
+func (m *SQLStore) queryRow(ctx context.Context, query string, args ...interface{}) RowScanner {
+	done := m.ops.hold()
+	return limitedRow{row: m.db.QueryRowContext(ctx, m.dialect.rebind(query), args...), done: done}
+}
+
+// query runs a query written with ? placeholders. The slot of
+// Options.MaxConcurrentOps is held until the rows are closed.
+func (m *SQLStore) query(ctx context.Context, query string, args ...interface{}) (*limitedRows, error) {
+	done := m.ops.hold()
+	rows, err := m.db.QueryContext(ctx, m.dialect.rebind(query), args...)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	return &limitedRows{Rows: rows, done: done}, nil
+}
+
+// placeholders returns n comma-separated ? placeholders for an IN list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
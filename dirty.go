@@ -0,0 +1,30 @@
+package sqlstore
+
+import (
+	"github.com/admpub/sessions"
+)
+
+// MarkDirty marks session as changed, so it is saved when
+// Options.SaveDirtyOnly is set.
+func (m *SQLStore) MarkDirty(session *sessions.Session) {
+	session.Values[m.keyPrefix+"dirty"] = true
+}
+
+// MarkClean undoes MarkDirty.
+func (m *SQLStore) MarkClean(session *sessions.Session) {
+	delete(session.Values, m.keyPrefix+"dirty")
+}
+
+// IsDirty reports whether session was marked with MarkDirty.
+func (m *SQLStore) IsDirty(session *sessions.Session) bool {
+	dirty, _ := session.Values[m.keyPrefix+"dirty"].(bool)
+	return dirty
+}
+
+// popDirty removes the dirty mark from session and reports whether it was
+// set.
+func (m *SQLStore) popDirty(session *sessions.Session) bool {
+	dirty := m.IsDirty(session)
+	delete(session.Values, m.keyPrefix+"dirty")
+	return dirty
+}
@@ -0,0 +1,60 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/sessions"
+)
+
+var ErrNoElevatedColumn = errors.New("sqlstore: Options.ElevatedColumn is not set")
+
+// Elevate marks session as having passed step-up authentication for d, or
+// ends the elevation if d is not positive. A stored session is updated at
+// once; a new one on its first save.
+func (m *SQLStore) Elevate(ctx context.Context, session *sessions.Session, d time.Duration) error {
+	if !m.elevatedCol {
+		return ErrNoElevatedColumn
+	}
+	var until int64
+	if d > 0 {
+		until = m.stamp(m.clock.Now().Add(d))
+	}
+	session.Values[m.keyPrefix+"elevatedUntil"] = until
+	if session.IsNew || len(session.ID) == 0 {
+		return nil
+	}
+	st, err := m.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.release(st)
+	_, err = m.exec(ctx, "UPDATE "+st.table+" SET elevated_until = ? WHERE id = ?", m.dbStamp(until), session.ID)
+	return err
+}
+
+// ElevatedUntil returns the end of the step-up authentication of session,
+// as loaded from the `elevated_until` column or set by Elevate.
+func (m *SQLStore) ElevatedUntil(session *sessions.Session) (time.Time, bool) {
+	until, _ := session.Values[m.keyPrefix+"elevatedUntil"].(int64)
+	if until == 0 {
+		return time.Time{}, false
+	}
+	return m.fromStamp(until), true
+}
+
+// IsElevated reports whether session is within a step-up authentication
+// granted by Elevate.
+func (m *SQLStore) IsElevated(session *sessions.Session) bool {
+	until, ok := m.ElevatedUntil(session)
+	return ok && until.After(m.clock.Now())
+}
+
+// popElevated removes the elevation of session from its values, to be
+// stored in the `elevated_until` column instead.
+func (m *SQLStore) popElevated(session *sessions.Session) int64 {
+	until, _ := session.Values[m.keyPrefix+"elevatedUntil"].(int64)
+	delete(session.Values, m.keyPrefix+"elevatedUntil")
+	return until
+}
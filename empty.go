@@ -0,0 +1,37 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/admpub/sessions"
+)
+
+// isEmpty reports whether session holds no values besides the store's own
+// bookkeeping keys, whatever the serialized size of its payload.
+func (m *SQLStore) isEmpty(session *sessions.Session) bool {
+	for k := range session.Values {
+		if key, ok := k.(string); !ok || !strings.HasPrefix(key, m.keyPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// emptyFlag returns the value of the is_empty column for session.
+func (m *SQLStore) emptyFlag(session *sessions.Session) int64 {
+	if m.isEmpty(session) {
+		return 1
+	}
+	return 0
+}
+
+// deleteEmpty deletes the sessions flagged empty that were not modified
+// since before.
+func (m *SQLStore) deleteEmpty(before int64) error {
+	n, err := m.execTables(context.Background(), func(table string) string {
+		return "DELETE FROM " + table + " WHERE is_empty = 1 AND modified < ?"
+	}, m.dbStamp(before))
+	m.gcDeleted.Add(n)
+	return err
+}
@@ -0,0 +1,117 @@
+package sqlstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"strings"
+
+	"github.com/admpub/errors"
+)
+
+// sealedPrefix marks the values encrypted for Options.EncryptedKeys.
+const sealedPrefix = "\x00sealed\x00"
+
+var ErrSealedValue = errors.New("Session value cannot be decrypted")
+
+// newValueCipher returns the AEAD for Options.EncryptionKey.
+func newValueCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealValues returns a copy of values with the values of the encrypted keys
+// sealed, or values itself if it has none of them.
+func (m *SQLStore) sealValues(values map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+	var sealed map[interface{}]interface{}
+	for key := range m.encKeys {
+		v, ok := values[key]
+		if !ok {
+			continue
+		}
+		if sealed == nil {
+			sealed = make(map[interface{}]interface{}, len(values))
+			for k, v := range values {
+				sealed[k] = v
+			}
+		}
+		s, err := m.sealValue(key, v)
+		if err != nil {
+			return nil, err
+		}
+		sealed[key] = s
+	}
+	if sealed == nil {
+		return values, nil
+	}
+	return sealed, nil
+}
+
+// sealValue serializes v on its own and encrypts it with key as additional
+// data, so sealed values cannot be moved between keys.
+func (m *SQLStore) sealValue(key string, v interface{}) (string, error) {
+	plain, err := m.serializeValue(key, v)
+	if err != nil {
+		return ``, err
+	}
+	nonce := make([]byte, m.valueAEAD.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return ``, err
+	}
+	sealed := m.valueAEAD.Seal(nonce, nonce, plain, []byte(key))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openValues decrypts in place the values sealed by sealValues.
+func (m *SQLStore) openValues(values map[interface{}]interface{}) error {
+	for key := range m.encKeys {
+		s, ok := values[key].(string)
+		if !ok || !strings.HasPrefix(s, sealedPrefix) {
+			continue
+		}
+		sealed, err := base64.RawStdEncoding.DecodeString(s[len(sealedPrefix):])
+		if err != nil || len(sealed) < m.valueAEAD.NonceSize() {
+			return ErrSealedValue
+		}
+		n := m.valueAEAD.NonceSize()
+		plain, err := m.valueAEAD.Open(nil, sealed[:n], sealed[n:], []byte(key))
+		if err != nil {
+			return ErrSealedValue
+		}
+		v, err := m.deserializeValue(key, plain)
+		if err != nil {
+			return err
+		}
+		values[key] = v
+	}
+	return nil
+}
+
+// serializeValue encodes v as a one-entry map with the store's serializer.
+func (m *SQLStore) serializeValue(key string, v interface{}) ([]byte, error) {
+	single := map[interface{}]interface{}{key: v}
+	if m.serializer != nil {
+		return m.serializer.Serialize(single)
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(single)
+	return buf.Bytes(), err
+}
+
+// deserializeValue is the inverse of serializeValue.
+func (m *SQLStore) deserializeValue(key string, data []byte) (interface{}, error) {
+	single := map[interface{}]interface{}{}
+	var err error
+	if m.serializer != nil {
+		err = m.serializer.Deserialize(data, &single)
+	} else {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&single)
+	}
+	return single[key], err
+}
@@ -0,0 +1,30 @@
+package sqlstore
+
+import (
+	"net/http"
+)
+
+// appendEnriched appends the values Options.Enrich derives from the request
+// of r for the enrichment columns to args. Missing values are stored as
+// NULL.
+func (m *SQLStore) appendEnriched(args []interface{}, r requestContext) []interface{} {
+	if len(m.enrichCols) == 0 {
+		return args
+	}
+	var values []interface{}
+	if req := r.Request(); req != nil {
+		values = m.enrich(req)
+	}
+	for i := range m.enrichCols {
+		if i < len(values) {
+			args = append(args, values[i])
+		} else {
+			args = append(args, nil)
+		}
+	}
+	return args
+}
+
+// EnrichFunc derives metadata values, e.g. IP address, user agent, country,
+// ASN or device class, from the request that creates a session.
+type EnrichFunc func(r *http.Request) []interface{}
@@ -0,0 +1,77 @@
+package sqlstore
+
+import (
+	"context"
+)
+
+// evictBatch is the number of sessions removed per statement when a table
+// is over Options.MaxRows.
+const evictBatch = 500
+
+// evictOverQuota removes the least recently modified sessions until every
+// session table holds no more than Options.MaxRows rows.
+func (m *SQLStore) evictOverQuota() error {
+	tables, err := m.sessionTables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err = m.evictTable(context.Background(), table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evictTable evicts the sessions of table over Options.MaxRows.
+func (m *SQLStore) evictTable(ctx context.Context, table string) error {
+	var rows int64
+	if err := m.queryRow(ctx, "SELECT COUNT(*) FROM "+table).Scan(&rows); err != nil {
+		return err
+	}
+	excess := rows - m.maxRows
+	if excess <= 0 {
+		return nil
+	}
+	m.logf(ctx, "%d sessions of %s over the quota of %d, evicting the oldest", excess, table, m.maxRows)
+	for excess > 0 {
+		n := int64(evictBatch)
+		if excess < n {
+			n = excess
+		}
+		ids, err := m.oldestIDs(ctx, table, n)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		result, err := m.exec(ctx, "DELETE FROM "+table+" WHERE id IN ("+placeholders(len(ids))+")", args...)
+		if err != nil {
+			return err
+		}
+		m.countDeleted(result)
+		excess -= int64(len(ids))
+	}
+	return nil
+}
+
+// oldestIDs returns the IDs of the n least recently modified sessions of
+// table.
+func (m *SQLStore) oldestIDs(ctx context.Context, table string, n int64) ([]string, error) {
+	rows, err := m.query(ctx, "SELECT id FROM "+table+" ORDER BY modified LIMIT ?", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,94 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// ExpiresHeaderName is the conventional name for Options.ExpiresHeader.
+const ExpiresHeaderName = `X-Session-Expires`
+
+// SetExpiry pins the expiry of session to t. The pinned time is kept in the
+// session values and overrides the MaxAge-derived expiry on every later save
+// until ClearExpiry is called. An already stored session is updated at once,
+// and an extension queued by Options.ExpiryWriteBack is discarded.
+func (m *SQLStore) SetExpiry(ctx context.Context, session *sessions.Session, t time.Time) error {
+	session.Values[m.keyPrefix+"pinnedExpiry"] = m.stamp(t)
+	if len(session.ID) == 0 {
+		return nil
+	}
+	m.dropExpiryAll(session.ID)
+	_, err := m.execTables(ctx, func(table string) string {
+		return "UPDATE " + table + " SET expires = ? WHERE id = ?"
+	}, m.dbTime(t), session.ID)
+	return err
+}
+
+// ClearExpiry removes an expiry pinned by SetExpiry, so the next save derives
+// the expiry from MaxAge again.
+func (m *SQLStore) ClearExpiry(session *sessions.Session) {
+	delete(session.Values, m.keyPrefix+"pinnedExpiry")
+}
+
+// pinnedExpiry returns the expiry pinned by SetExpiry, if any.
+func (m *SQLStore) pinnedExpiry(session *sessions.Session) (int64, bool) {
+	ts, ok := session.Values[m.keyPrefix+"pinnedExpiry"].(int64)
+	return ts, ok
+}
+
+// TTL returns the time left until the session sessionID expires. It fails
+// with sql.ErrNoRows for an unknown session and with ErrSessionExpired for
+// an expired one.
+func (m *SQLStore) TTL(ctx context.Context, sessionID string) (time.Duration, error) {
+	var expires unixTime
+	err := m.scanFirst(ctx, func(table string) string {
+		return "SELECT expires FROM " + table + " WHERE id = ?" + m.notDeleted()
+	}, []interface{}{sessionID}, &expires)
+	if err != nil {
+		return 0, err
+	}
+	ttl := m.fromStamp(expires.ts).Sub(m.clock.Now())
+	if ttl < 0 {
+		return 0, ErrSessionExpired
+	}
+	return ttl, nil
+}
+
+// setExpiresHeader reports the expiry of a saved session to the client.
+func (m *SQLStore) setExpiresHeader(r requestContext, expires int64) {
+	if len(m.expiresHeader) > 0 {
+		r.SetHeader(m.expiresHeader, strconv.FormatInt(expires, 10))
+	}
+}
+
+// InvalidateCreatedBefore expires every session created before t, e.g. after
+// a credential or signing key was compromised, and returns the number of
+// sessions expired. Their rows are deleted by the next cleanup pass.
+func (m *SQLStore) InvalidateCreatedBefore(ctx context.Context, t time.Time) (int64, error) {
+	if m.readOnly.Load() {
+		return 0, ErrReadOnly
+	}
+	m.clearExpiries()
+	n, err := m.execTables(ctx, func(table string) string {
+		return "UPDATE " + table + " SET expires = ? WHERE created < ? AND expires > ?"
+	}, m.dbStamp(0), m.dbTime(t), m.dbStamp(0))
+	m.checkMassDelete("InvalidateCreatedBefore", n)
+	return n, err
+}
+
+// Exists reports whether sessionID is a live session, without fetching or
+// decoding its payload.
+func (m *SQLStore) Exists(ctx context.Context, sessionID string) (bool, error) {
+	var one int
+	err := m.scanFirst(ctx, func(table string) string {
+		return "SELECT 1 FROM " + table + " WHERE id = ? AND expires >= ?" + m.notDeleted()
+	}, []interface{}{sessionID, m.dbTime(m.clock.Now().Add(-m.clockSkew))}, &one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,122 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/admpub/errors"
+)
+
+// DefaultFailoverBackoff is the wait between write retries during a
+// failover when Options.FailoverBackoff is not set.
+var DefaultFailoverBackoff = time.Second
+
+// MySQL error numbers raised by a primary that was demoted or is going away
+// during a group replication, Galera or Aurora failover.
+var failoverErrors = map[uint16]bool{
+	1053: true, // ER_SERVER_SHUTDOWN
+	1290: true, // ER_OPTION_PREVENTS_STATEMENT, e.g. --read-only
+	1792: true, // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION
+	1836: true, // ER_READ_ONLY_MODE
+	3100: true, // ER_RUN_HOOK_ERROR, group replication rejected the commit
+}
+
+// errInvalidConn is the message of the invalid connection error of
+// github.com/go-sql-driver/mysql.
+const errInvalidConn = `invalid connection`
+
+// isFailover reports whether err is typical of a write reaching a demoted or
+// vanished primary.
+func (m *SQLStore) isFailover(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if e.Error() == errInvalidConn {
+			return true
+		}
+	}
+	number, _, ok := m.errorNumber(err)
+	return ok && failoverErrors[number]
+}
+
+// mysqlError returns the number and message of a MySQL server error in the
+// chain of err, parsed from the "Error 1213 (40001): message" text of the
+// driver error, so the package does not link a MySQL driver. It is the
+// default of Options.ErrorNumber.
+func mysqlError(err error) (number uint16, message string, ok bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		text, found := strings.CutPrefix(err.Error(), `Error `)
+		if !found {
+			continue
+		}
+		end := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' })
+		if end <= 0 {
+			continue
+		}
+		n, parseErr := strconv.ParseUint(text[:end], 10, 16)
+		if parseErr != nil {
+			continue
+		}
+		if i := strings.Index(text, `: `); i >= 0 {
+			message = text[i+2:]
+		}
+		return uint16(n), message, true
+	}
+	return 0, ``, false
+}
+
+// execWrite runs a write statement through writeRetried.
+func (m *SQLStore) execWrite(s stmt, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := m.writeRetried(func() (err error) {
+		result, err = s.Exec(args...)
+		return err
+	})
+	return result, err
+}
+
+// execStmt runs s, one of the statements of st, like execWrite. Statements
+// bound to a transaction run once, as the transaction is retried as a whole.
+func (m *SQLStore) execStmt(st *statements, s stmt, args ...interface{}) (sql.Result, error) {
+	if st.tx {
+		return s.Exec(args...)
+	}
+	return m.execWrite(s, args...)
+}
+
+// writeRetried runs write within the write rate limit. On failover errors
+// it drops the idle connections, which may still point at the old primary,
+// and retries up to Options.MaxReconnect times; Galera certification
+// conflicts are retried as well.
+func (m *SQLStore) writeRetried(write func() error) error {
+	if !m.allowWrite() {
+		return ErrWriteLimited
+	}
+	err := write()
+	for attempt := 0; err != nil && attempt < m.maxReconnect && m.isFailover(err); attempt++ {
+		m.logf(context.Background(), "write failed during failover, retrying: %v", err)
+		m.dropIdleConns()
+		time.Sleep(m.failoverWait)
+		err = write()
+	}
+	if m.galera {
+		return m.retryWsrep(write, err)
+	}
+	return err
+}
+
+// dropIdleConns closes the idle connections of the pool. Only a pool opened
+// by NewWithDSN is touched: the settings of a caller's *sql.DB cannot be
+// read back to restore them, and may be shared with the rest of the app.
+func (m *SQLStore) dropIdleConns() {
+	if m.idleConns <= 0 {
+		return
+	}
+	m.db.SetMaxIdleConns(0)
+	m.db.SetMaxIdleConns(m.idleConns)
+}
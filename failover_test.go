@@ -0,0 +1,215 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/admpub/securecookie"
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+)
+
+// flakyDriver is the SQLite driver failing the next Fail writes with Err,
+// like a primary that was demoted under the store. Each write takes Delay,
+// like a database under load.
+type flakyDriver struct {
+	sqlite3.SQLiteDriver
+	Fail  atomic.Int32
+	Err   error
+	Delay atomic.Int64
+
+	mu   sync.Mutex
+	keep map[string]driver.Conn
+}
+
+func (d *flakyDriver) Open(dsn string) (driver.Conn, error) {
+	// The store drops its idle connections on failover; an extra connection
+	// keeps the in-memory database alive meanwhile.
+	d.mu.Lock()
+	if _, ok := d.keep[dsn]; !ok {
+		if conn, err := d.SQLiteDriver.Open(dsn); err == nil {
+			d.keep[dsn] = conn
+		}
+	}
+	d.mu.Unlock()
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return flakyConn{conn.(*sqlite3.SQLiteConn), d}, nil
+}
+
+type flakyConn struct {
+	*sqlite3.SQLiteConn
+	d *flakyDriver
+}
+
+// mysqlValues matches the VALUES(col) references of a MySQL upsert.
+var mysqlValues = regexp.MustCompile(`VALUES\((\w+)\)`)
+
+func (c flakyConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	// Stores of the MySQL dialects and Postgres run on SQLite, so their
+	// upsert is translated.
+	if insert, sets, ok := strings.Cut(query, ` ON DUPLICATE KEY UPDATE `); ok {
+		query = insert + ` ON CONFLICT (id) DO UPDATE SET ` + mysqlValues.ReplaceAllString(sets, `excluded.$1`)
+	}
+	query = strings.Replace(query, ` RETURNING (xmax = 0)`, ` RETURNING 1`, 1)
+	st, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	write := !strings.HasPrefix(strings.TrimSpace(query), `SELECT`)
+	return flakyStmt{st.(*sqlite3.SQLiteStmt), c.d, write}, nil
+}
+
+// ExecContext runs unprepared statements as prepared ones, so they can fail
+// too.
+func (c flakyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	st, err := c.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	return st.(flakyStmt).ExecContext(ctx, args)
+}
+
+type flakyStmt struct {
+	*sqlite3.SQLiteStmt
+	d     *flakyDriver
+	write bool
+}
+
+// fail delays a write and returns Err while writes are to fail.
+func (s flakyStmt) fail() error {
+	if !s.write {
+		return nil
+	}
+	time.Sleep(time.Duration(s.d.Delay.Load()))
+	if s.d.Fail.Add(-1) >= 0 {
+		return s.d.Err
+	}
+	return nil
+}
+
+func (s flakyStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.SQLiteStmt.ExecContext(ctx, args)
+}
+
+// QueryContext serves writes returning rows, e.g. INSERT ... RETURNING.
+func (s flakyStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.SQLiteStmt.QueryContext(ctx, args)
+}
+
+var flaky = &flakyDriver{keep: map[string]driver.Conn{}, Err: &mysql.MySQLError{Number: 1290, Message: `The MySQL server is running with the --read-only option`}}
+
+func init() {
+	sql.Register(`sqlite3_flaky`, flaky)
+}
+
+func TestFailoverRetriesWrites(t *testing.T) {
+	sqlstoretest.DriverName = `sqlite3_flaky`
+	defer func() { sqlstoretest.DriverName = `sqlite3` }()
+	s := sqlstoretest.New(t, &sqlstore.Options{MaxReconnect: 2, FailoverBackoff: time.Millisecond})
+	c := newClient(t, s.SQLStore)
+
+	flaky.Fail.Store(2)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if values, _, _ := s.Lookup(session.ID); values[`user`] != `alice` {
+		t.Fatalf(`stored %v after two failed attempts, want user alice`, values)
+	}
+
+	flaky.Fail.Store(3)
+	defer flaky.Fail.Store(0)
+	r, session = c.get()
+	session.Values[`user`] = `bob`
+	if err := c.h.Save(httptest.NewRecorder(), r, session); err == nil {
+		t.Fatal(`a write failing more than MaxReconnect times succeeded`)
+	}
+}
+
+func TestFailoverRetriesPostgresInserts(t *testing.T) {
+	db, err := sql.Open(`sqlite3_flaky`, `file:failoverpg?mode=memory&cache=shared`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	cfg := &sqlstore.Options{Dialect: sqlstore.Postgres, MaxReconnect: 2, FailoverBackoff: time.Millisecond,
+		KeyPairs: [][]byte{securecookie.GenerateRandomKey(32)}}
+	cfg.SetDDL(sqlstoretest.DDL)
+	s, err := sqlstore.New(db, cfg)
+	if err != nil {
+		t.Fatalf(`New: %v`, err)
+	}
+	defer s.Close()
+	c := newClient(t, s)
+
+	// The insert reports whether it created the row with RETURNING.
+	flaky.Fail.Store(2)
+	defer flaky.Fail.Store(0)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if !s.Inserted(session) {
+		t.Fatal(`the retried insert did not report the new row`)
+	}
+	if _, session = c.get(); session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v after two failed inserts, want user alice`, session.Values)
+	}
+}
+
+// readOnlyError is a driver error without the text of a MySQL server error.
+type readOnlyError struct{ number uint16 }
+
+func (e *readOnlyError) Error() string { return `server is read-only` }
+
+func TestFailoverUsesErrorNumber(t *testing.T) {
+	sqlstoretest.DriverName = `sqlite3_flaky`
+	defer func() { sqlstoretest.DriverName = `sqlite3` }()
+	defer func(err error) { flaky.Err = err }(flaky.Err)
+	flaky.Err = &readOnlyError{number: 1290}
+	defer flaky.Fail.Store(0)
+
+	s := sqlstoretest.New(t, &sqlstore.Options{MaxReconnect: 2, FailoverBackoff: time.Millisecond})
+	flaky.Fail.Store(1)
+	r, session := newClient(t, s.SQLStore).get()
+	if err := newClient(t, s.SQLStore).h.Save(httptest.NewRecorder(), r, session); err == nil {
+		t.Fatal(`an unrecognized driver error was retried`)
+	}
+
+	s = sqlstoretest.New(t, &sqlstore.Options{MaxReconnect: 2, FailoverBackoff: time.Millisecond,
+		ErrorNumber: func(err error) (uint16, string, bool) {
+			var e *readOnlyError
+			if errors.As(err, &e) {
+				return e.number, e.Error(), true
+			}
+			return 0, ``, false
+		}})
+	c := newClient(t, s.SQLStore)
+	flaky.Fail.Store(1)
+	r, session = c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if values, _, _ := s.Lookup(session.ID); values[`user`] != `alice` {
+		t.Fatalf(`stored %v after a failed attempt, want user alice`, values)
+	}
+}
@@ -0,0 +1,65 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/admpub/sessions"
+)
+
+// Flags are session attributes stored in the `flags` column, outside the
+// opaque payload, when Options.Flags is enabled.
+type Flags uint32
+
+const (
+	FlagPersistent   Flags = 1 << iota // "remember me" session
+	FlagElevated                       // step-up authentication passed
+	FlagMFAVerified                    // second factor verified
+	FlagImpersonated                   // an operator acts as the user
+)
+
+// Has reports whether all bits of flag are set.
+func (f Flags) Has(flag Flags) bool {
+	return f&flag == flag
+}
+
+func (f Flags) Persistent() bool   { return f.Has(FlagPersistent) }
+func (f Flags) Elevated() bool     { return f.Has(FlagElevated) }
+func (f Flags) MFAVerified() bool  { return f.Has(FlagMFAVerified) }
+func (f Flags) Impersonated() bool { return f.Has(FlagImpersonated) }
+
+// Flags returns the flags of session.
+func (m *SQLStore) Flags(session *sessions.Session) Flags {
+	flags, _ := session.Values[m.keyPrefix+"flags"].(Flags)
+	return flags
+}
+
+// SetFlags replaces the flags of session. They are written on the next save.
+func (m *SQLStore) SetFlags(session *sessions.Session, flags Flags) {
+	session.Values[m.keyPrefix+"flags"] = flags
+}
+
+// SetFlag sets or clears flag on session.
+func (m *SQLStore) SetFlag(session *sessions.Session, flag Flags, on bool) {
+	flags := m.Flags(session)
+	if on {
+		flags |= flag
+	} else {
+		flags &^= flag
+	}
+	m.SetFlags(session, flags)
+}
+
+// CountFlagged returns the number of unexpired sessions that have all bits
+// of flag set.
+func (m *SQLStore) CountFlagged(ctx context.Context, flag Flags) (int64, error) {
+	return m.countTables(ctx, func(table string) string {
+		return "SELECT COUNT(*) FROM " + table + " WHERE flags & ? = ? AND expires >= ?" + m.notDeleted()
+	}, int64(flag), int64(flag), m.dbTime(m.clock.Now()))
+}
+
+// popFlags removes the flags meta value from session and returns it.
+func (m *SQLStore) popFlags(session *sessions.Session) Flags {
+	flags := m.Flags(session)
+	delete(session.Values, m.keyPrefix+"flags")
+	return flags
+}
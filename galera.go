@@ -0,0 +1,62 @@
+package sqlstore
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// galeraRetries is the number of times a write failing a Galera
+// certification is retried.
+const galeraRetries = 3
+
+// galeraBatch bounds the rows a GC statement deletes in Options.Galera mode,
+// keeping each write-set small.
+const galeraBatch = 1000
+
+// isWsrepConflict reports whether err is a Galera certification conflict or
+// a node not yet ready, which succeed when retried.
+func (m *SQLStore) isWsrepConflict(err error) bool {
+	number, message, ok := m.errorNumber(err)
+	if !ok {
+		return false
+	}
+	switch number {
+	case 1213: // ER_LOCK_DEADLOCK, raised for certification failures
+		return true
+	case 1047: // ER_UNKNOWN_COM_ERROR, "WSREP has not yet prepared node"
+		return strings.Contains(message, "WSREP")
+	}
+	return false
+}
+
+// retryWsrep retries a write that failed with a certification conflict,
+// with a short growing pause.
+func (m *SQLStore) retryWsrep(write func() error, err error) error {
+	for attempt := 1; err != nil && attempt <= galeraRetries && m.isWsrepConflict(err); attempt++ {
+		time.Sleep(time.Duration(attempt) * 10 * time.Millisecond)
+		err = write()
+	}
+	return err
+}
+
+// deleteExpiredBatched deletes the sessions that expired before cutoff in
+// statements of at most galeraBatch rows.
+func (m *SQLStore) deleteExpiredBatched(cutoff int64) error {
+	query := m.gcExpiredSQL(m.tableName()) + " LIMIT " + strconv.Itoa(galeraBatch)
+	for {
+		result, err := m.execRaw(context.Background(), query, m.dbStamp(cutoff))
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		m.gcDeleted.Add(n)
+		if n < galeraBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package sqlstore_test
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/admpub/securecookie"
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestGaleraRetriesCertificationConflicts(t *testing.T) {
+	db, err := sql.Open(`sqlite3_flaky`, `file:galera?mode=memory&cache=shared`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	cfg := &sqlstore.Options{Dialect: sqlstore.MariaDB, Galera: true, KeyPairs: [][]byte{securecookie.GenerateRandomKey(32)}}
+	cfg.SetDDL(sqlstoretest.DDL)
+	s, err := sqlstore.New(db, cfg)
+	if err != nil {
+		t.Fatalf(`New: %v`, err)
+	}
+	defer s.Close()
+
+	failoverErr := flaky.Err
+	flaky.Err = &mysql.MySQLError{Number: 1213, Message: `Deadlock found when trying to get lock; try restarting transaction`}
+	defer func() { flaky.Err = failoverErr }()
+	defer flaky.Fail.Store(0)
+	c := newClient(t, s)
+
+	// A conflict is retried even without MaxReconnect.
+	flaky.Fail.Store(2)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if _, session = c.get(); session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v after two conflicts, want user alice`, session.Values)
+	}
+
+	flaky.Fail.Store(10)
+	r, session = c.get()
+	session.Values[`user`] = `bob`
+	if err := c.h.Save(httptest.NewRecorder(), r, session); err == nil {
+		t.Fatal(`a write failing certification on every retry succeeded`)
+	}
+}
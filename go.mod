@@ -4,13 +4,17 @@ go 1.23.0
 
 require (
 	github.com/admpub/errors v0.8.2
-	github.com/admpub/null v8.0.4+incompatible
 	github.com/admpub/securecookie v1.3.0
 	github.com/admpub/sessions v0.2.3
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/gorilla/sessions v1.2.2
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/webx-top/echo v1.14.5
 )
 
 require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/admpub/color v1.8.1 // indirect
 	github.com/admpub/decimal v1.3.1 // indirect
 	github.com/admpub/events v1.3.6 // indirect
@@ -19,13 +23,11 @@ require (
 	github.com/admpub/go-reuseport v0.0.4 // indirect
 	github.com/admpub/humanize v0.0.0-20190501023926-5f826e92c8ca // indirect
 	github.com/admpub/log v1.3.6 // indirect
-	github.com/admpub/randomize v0.0.2 // indirect
 	github.com/admpub/realip v0.2.7 // indirect
 	github.com/admpub/timeago v1.2.2 // indirect
 	github.com/francoispqt/gojay v1.2.13 // indirect
-	github.com/friendsofgo/errors v0.9.2 // indirect
 	github.com/goccy/go-json v0.10.4 // indirect
-	github.com/gofrs/uuid v4.4.0+incompatible // indirect
+	github.com/gorilla/securecookie v1.1.2 // indirect
 	github.com/hashicorp/go-version v1.7.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
@@ -34,8 +36,6 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/volatiletech/inflect v0.0.1 // indirect
-	github.com/volatiletech/strmangle v0.0.8 // indirect
 	github.com/webx-top/captcha v0.1.0 // indirect
 	github.com/webx-top/codec v0.3.0 // indirect
 	github.com/webx-top/com v1.3.20 // indirect
@@ -0,0 +1,73 @@
+package sqlstore
+
+import (
+	"net/http"
+
+	"github.com/admpub/sessions"
+	gsessions "github.com/gorilla/sessions"
+)
+
+var _ gsessions.Store = (*GorillaStore)(nil)
+
+// GorillaStore adapts a SQLStore to gorilla/sessions.Store. Sessions share the
+// table, encoding and cookie format with the echo front end, so gorilla and
+// echo handlers can use one session backend.
+type GorillaStore struct {
+	store   *SQLStore
+	Options *gsessions.Options // default cookie options of new sessions
+}
+
+// NewGorillaStore returns a gorilla/sessions front end for store. A nil
+// options uses the path "/" and the store's default lifetime.
+func NewGorillaStore(store *SQLStore, options *gsessions.Options) *GorillaStore {
+	if options == nil {
+		options = &gsessions.Options{Path: `/`}
+	}
+	return &GorillaStore{store: store, Options: options}
+}
+
+// Get returns the named session, cached in the gorilla registry of r.
+func (g *GorillaStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(g, name)
+}
+
+// New loads the named session referenced by the cookie of r. A new session is
+// returned if r carries no valid session cookie.
+func (g *GorillaStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	g.store.Init()
+	options := *g.Options
+	session := gsessions.NewSession(g, name)
+	session.Options = &options
+	s, err := g.store.newSession(g.request(nil, r, &options), name)
+	session.ID = s.ID
+	session.Values = s.Values
+	session.IsNew = s.IsNew
+	return session, err
+}
+
+// Save persists session and writes its cookie to w. A negative MaxAge in the
+// session options deletes the session.
+func (g *GorillaStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	options := session.Options
+	if options == nil {
+		options = g.Options
+	}
+	s := sessions.NewSession(g.store, session.Name())
+	s.ID = session.ID
+	s.Values = session.Values
+	s.IsNew = session.IsNew
+	err := g.store.saveSession(g.request(w, r, options), s)
+	session.ID = s.ID
+	return err
+}
+
+func (g *GorillaStore) request(w http.ResponseWriter, r *http.Request, options *gsessions.Options) httpRequest {
+	return httpRequest{w: w, r: r, options: &HTTPCookieOptions{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+		SameSite: options.SameSite,
+	}}
+}
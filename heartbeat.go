@@ -0,0 +1,156 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/admpub/errors"
+)
+
+var ErrNoHeartbeat = errors.New("sqlstore: Options.HeartbeatTable is not set")
+
+// DefaultHeartbeatInterval is the heartbeat period used when
+// Options.HeartbeatInterval is not set.
+var DefaultHeartbeatInterval = 30 * time.Second
+
+// DDL for the heartbeat table of Options.HeartbeatTable.
+const (
+	MySQLHeartbeatDDL = "CREATE TABLE IF NOT EXISTS %s (" +
+		"`id` varchar(100) NOT NULL, " +
+		"`last_seen` bigint NOT NULL DEFAULT 0, " +
+		"`sessions_created` bigint NOT NULL DEFAULT 0, " +
+		"PRIMARY KEY (`id`)" +
+		") ENGINE=InnoDB"
+
+	PostgresHeartbeatDDL = `CREATE TABLE IF NOT EXISTS %s (` +
+		`id varchar(100) NOT NULL PRIMARY KEY, ` +
+		`last_seen bigint NOT NULL DEFAULT 0, ` +
+		`sessions_created bigint NOT NULL DEFAULT 0)`
+)
+
+// InstanceStats is the last heartbeat of an application instance.
+type InstanceStats struct {
+	ID       string    `json:"id"`
+	LastSeen time.Time `json:"lastSeen"`
+	// SessionsCreated is the number of sessions the instance created since
+	// it started.
+	SessionsCreated int64 `json:"sessionsCreated"`
+	// Live reports whether the instance heartbeated within the last three
+	// intervals.
+	Live bool `json:"live"`
+	// Leader marks the live instance with the lowest ID, which runs GC
+	// when Options.GCLeaderOnly is set.
+	Leader bool `json:"leader"`
+}
+
+// ClusterStats returns the heartbeats of all instances sharing the heartbeat
+// table, ordered by ID. It requires Options.HeartbeatTable.
+func (m *SQLStore) ClusterStats(ctx context.Context) ([]InstanceStats, error) {
+	if len(m.hbTable) == 0 {
+		return nil, ErrNoHeartbeat
+	}
+	rows, err := m.query(ctx, "SELECT id, last_seen, sessions_created FROM "+m.hbTable+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	live := m.clock.Now().Add(-3 * m.hbInterval).Unix()
+	var list []InstanceStats
+	var leader bool
+	for rows.Next() {
+		var s InstanceStats
+		var seen int64
+		if err = rows.Scan(&s.ID, &seen, &s.SessionsCreated); err != nil {
+			return nil, err
+		}
+		s.LastSeen = time.Unix(seen, 0)
+		s.Live = seen >= live
+		if s.Live && !leader {
+			s.Leader, leader = true, true
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// isGCLeader reports whether this instance is the GC leader. Errors are
+// reported and count as not being the leader, so that a pass is skipped
+// rather than run twice.
+func (m *SQLStore) isGCLeader() bool {
+	list, err := m.ClusterStats(context.Background())
+	if err != nil {
+		m.logf(context.Background(), "unable to read heartbeats: %v", err)
+		m.reportError(OpHeartbeat, ``, err)
+		return false
+	}
+	for _, s := range list {
+		if s.Leader {
+			return s.ID == m.instanceID
+		}
+	}
+	return false
+}
+
+// createHeartbeatTable runs Options.HeartbeatDDL.
+func (m *SQLStore) createHeartbeatTable(ddl string) error {
+	_, err := m.execRaw(context.Background(), fmt.Sprintf(ddl, m.hbTable))
+	return err
+}
+
+// heartbeat records that this instance is alive.
+func (m *SQLStore) heartbeat() error {
+	_, err := m.exec(context.Background(), m.dialect.upsert(m.hbTable, []string{"id", "last_seen", "sessions_created"}, false),
+		m.instanceID, m.clock.Now().Unix(), m.newSessions.Load())
+	return err
+}
+
+// runHeartbeat heartbeats every interval until quit is closed.
+func (m *SQLStore) runHeartbeat(quit <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.hbInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.heartbeat(); err != nil {
+			m.logf(context.Background(), "unable to heartbeat: %v", err)
+			m.reportError(OpHeartbeat, ``, err)
+		}
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startHeartbeat starts heartbeating if a heartbeat table is configured.
+func (m *SQLStore) startHeartbeat() {
+	if len(m.hbTable) == 0 {
+		return
+	}
+	quit, done := make(chan struct{}), make(chan struct{})
+	m.mu.Lock()
+	m.hbQuit, m.hbDone = quit, done
+	m.mu.Unlock()
+	go m.runHeartbeat(quit, done)
+}
+
+// stopHeartbeat stops heartbeating and waits for a running heartbeat.
+func (m *SQLStore) stopHeartbeat() {
+	m.mu.Lock()
+	quit, done := m.hbQuit, m.hbDone
+	m.hbQuit, m.hbDone = nil, nil
+	m.mu.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+}
+
+// defaultInstanceID identifies this process as "<host name>-<pid>".
+func defaultInstanceID() string {
+	host, _ := os.Hostname()
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
@@ -0,0 +1,103 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHedgeDelay is how long a load waits for the primary before also
+// reading from Options.Replica, unless Options.HedgeDelay is set.
+var DefaultHedgeDelay = 50 * time.Millisecond
+
+// DefaultHedgeQuiet is how long after a write of a session its loads are not
+// hedged, unless Options.HedgeQuiet is set.
+var DefaultHedgeQuiet = 5 * time.Second
+
+// recentWrites holds the sessions written by this instance within the hedge
+// quiet period and when.
+type recentWrites struct {
+	mu    sync.Mutex
+	at    map[string]time.Time
+	prune int // the size at which expired entries are dropped
+}
+
+// noteWrite records that sessionID is being written, so the replica may
+// not have it yet. Entries past the quiet period are dropped as the map
+// grows.
+func (m *SQLStore) noteWrite(sessionID string) {
+	if m.replica == nil {
+		return
+	}
+	now := m.clock.Now()
+	w := &m.written
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.at == nil {
+		w.at = map[string]time.Time{}
+	}
+	if len(w.at) >= w.prune {
+		for id, at := range w.at {
+			if now.Sub(at) >= m.hedgeQuiet {
+				delete(w.at, id)
+			}
+		}
+		w.prune = max(2*len(w.at), 1024)
+	}
+	w.at[sessionID] = now
+}
+
+// recentlyWritten reports whether sessionID was written within the hedge
+// quiet period.
+func (m *SQLStore) recentlyWritten(sessionID string) bool {
+	w := &m.written
+	w.mu.Lock()
+	at, ok := w.at[sessionID]
+	w.mu.Unlock()
+	return ok && m.clock.Now().Sub(at) < m.hedgeQuiet
+}
+
+// hedgeResult is the outcome of one of the reads of a hedged load.
+type hedgeResult struct {
+	row     Row
+	err     error
+	replica bool
+}
+
+// selectHedged reads the row of sessionID from the primary and, if that
+// takes longer than Options.HedgeDelay, also from the replica, returning
+// whichever succeeds first. Only the primary is trusted to report a missing
+// or failing row, as the replica may lag behind.
+func (m *SQLStore) selectHedged(st *statements, sessionID string) (Row, error) {
+	results := make(chan hedgeResult, 2)
+	go func() {
+		var r hedgeResult
+		r.err = m.rowMapper(st.selectRow.QueryRow(sessionID), m.selCols, &r.row)
+		results <- r
+	}()
+	timer := time.NewTimer(m.hedgeDelay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.row, r.err
+	case <-timer.C:
+	}
+	go func() {
+		r := hedgeResult{replica: true}
+		query := m.dialect.rebind("SELECT " + strings.Join(m.selCols, ", ") + " FROM " + st.table + " WHERE id = ?")
+		done := m.ops.hold()
+		r.err = m.rowMapper(m.replica.QueryRow(query, sessionID), m.selCols, &r.row)
+		done()
+		results <- r
+	}()
+	for {
+		r := <-results
+		if !r.replica || r.err == nil {
+			return r.row, r.err
+		}
+		if r.err != sql.ErrNoRows {
+			m.reportError(OpLoad, sessionID, r.err)
+		}
+	}
+}
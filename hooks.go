@@ -0,0 +1,24 @@
+package sqlstore
+
+// Operations reported to Options.OnError.
+const (
+	OpDecode = `decode` // decoding the session cookie
+	OpLoad   = `load`   // loading a session row
+	OpSave   = `save`   // writing a session row
+	OpGC     = `gc`     // deleting expired sessions
+
+	OpHeartbeat = `heartbeat` // recording or reading instance heartbeats
+)
+
+// reportError passes err to the OnError hook, if any, and keeps it for
+// DebugInfo.
+func (m *SQLStore) reportError(op string, sessionID string, err error) {
+	entry := ErrorEntry{Time: m.clock.Now(), Op: op, Error: err.Error()}
+	if t, ok := err.(*TraceError); ok {
+		entry.TraceID = t.TraceID
+	}
+	m.errLog.add(entry)
+	if m.onError != nil {
+		m.onError(op, sessionID, err)
+	}
+}
@@ -0,0 +1,146 @@
+package sqlstore
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// HTTPCookieOptions configures the session cookie written by HTTPStore.
+type HTTPCookieOptions struct {
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// HTTPStore exposes a SQLStore to plain net/http handlers. Sessions are kept
+// in the same table with the same encoding and cookie format, so echo and
+// net/http services can share them.
+type HTTPStore struct {
+	store   *SQLStore
+	Options *HTTPCookieOptions
+}
+
+// NewHTTPStore returns a net/http front end for store. A nil options uses the
+// path "/" and the store's default lifetime.
+func NewHTTPStore(store *SQLStore, options *HTTPCookieOptions) *HTTPStore {
+	if options == nil {
+		options = &HTTPCookieOptions{Path: `/`}
+	}
+	return &HTTPStore{store: store, Options: options}
+}
+
+// Get loads the named session referenced by the cookie of r. A new session is
+// returned if r carries no valid session cookie.
+func (h *HTTPStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	h.store.Init()
+	return h.store.newSession(h.request(nil, r), name)
+}
+
+// Reload reloads the values of session from the database.
+func (h *HTTPStore) Reload(r *http.Request, session *sessions.Session) error {
+	return h.store.reload(r.Context(), session)
+}
+
+// Save persists session and writes its cookie to w.
+func (h *HTTPStore) Save(w http.ResponseWriter, r *http.Request, session *sessions.Session) error {
+	return h.store.saveSession(h.request(w, r), session)
+}
+
+// Delete removes session from the database and expires its cookie.
+func (h *HTTPStore) Delete(w http.ResponseWriter, r *http.Request, session *sessions.Session) error {
+	return h.store.deleteSession(h.request(w, r), session)
+}
+
+func (h *HTTPStore) request(w http.ResponseWriter, r *http.Request) httpRequest {
+	return httpRequest{w: w, r: r, options: h.Options}
+}
+
+// httpRequest adapts a net/http request. w is nil while loading a session,
+// so cookie and header writes are skipped then; Save issues the cookie.
+type httpRequest struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	options *HTTPCookieOptions
+}
+
+func (r httpRequest) Cookie(name string) string {
+	cookie, err := r.r.Cookie(name)
+	if err != nil {
+		return ``
+	}
+	return cookie.Value
+}
+
+func (r httpRequest) SetCookie(name string, value string) {
+	if r.w == nil {
+		return
+	}
+	cookie := r.newCookie(name, value)
+	cookie.MaxAge = r.options.MaxAge
+	if r.options.MaxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(r.options.MaxAge) * time.Second)
+	} else if r.options.MaxAge < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	}
+	http.SetCookie(r.w, cookie)
+}
+
+func (r httpRequest) RemoveCookie(name string) {
+	if r.w == nil {
+		return
+	}
+	cookie := r.newCookie(name, ``)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(1, 0)
+	http.SetCookie(r.w, cookie)
+}
+
+func (r httpRequest) CookieMaxAge() int {
+	return r.options.MaxAge
+}
+
+func (r httpRequest) Context() context.Context {
+	return r.r.Context()
+}
+
+func (r httpRequest) Request() *http.Request {
+	return r.r
+}
+
+func (r httpRequest) IssuedCookie(name string) string {
+	if r.w == nil {
+		return ``
+	}
+	var value string
+	for _, cookie := range (&http.Response{Header: r.w.Header()}).Cookies() {
+		if cookie.Name == name {
+			value = cookie.Value
+		}
+	}
+	return value
+}
+
+func (r httpRequest) SetHeader(key string, value string) {
+	if r.w == nil {
+		return
+	}
+	r.w.Header().Set(key, value)
+}
+
+func (r httpRequest) newCookie(name string, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     r.options.Path,
+		Domain:   r.options.Domain,
+		Secure:   r.options.Secure,
+		HttpOnly: r.options.HttpOnly,
+		SameSite: r.options.SameSite,
+	}
+}
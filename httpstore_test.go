@@ -0,0 +1,44 @@
+package sqlstore_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+const garbageCookie = `not-a-session-cookie`
+
+func TestHTTPStoreGarbageCookie(t *testing.T) {
+	s := sqlstoretest.New(t, &sqlstore.Options{ResetInvalidCookie: true})
+	c := newClient(t, s.SQLStore)
+	c.cookies = []*http.Cookie{{Name: `SID`, Value: garbageCookie}}
+
+	r, session := c.get()
+	if !session.IsNew || len(session.ID) > 0 {
+		t.Fatalf(`Get returned session %q, want a new one`, session.ID)
+	}
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if len(c.cookies) == 0 || c.cookies[0].Name != `SID` || c.cookies[0].Value == garbageCookie {
+		t.Fatalf(`Save issued %v, want a fresh SID cookie`, c.cookies)
+	}
+	s.AssertExists(session.ID)
+}
+
+func TestGorillaStoreGarbageCookie(t *testing.T) {
+	s := sqlstoretest.New(t, &sqlstore.Options{ResetInvalidCookie: true})
+	g := sqlstore.NewGorillaStore(s.SQLStore, nil)
+
+	r := httptest.NewRequest(http.MethodGet, `/`, nil)
+	r.AddCookie(&http.Cookie{Name: `SID`, Value: garbageCookie})
+	session, err := g.New(r, `SID`)
+	if err != nil {
+		t.Fatalf(`New: %v`, err)
+	}
+	if !session.IsNew {
+		t.Fatal(`New returned a stored session for an invalid cookie`)
+	}
+}
@@ -0,0 +1,82 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/admpub/sessions"
+)
+
+// cookieMarker prefixes cookie values that carry the session values instead
+// of a session ID. Generated IDs are base32 and never contain it.
+const cookieMarker = `!`
+
+// rowMetaKeys are the values a load sets from the columns of the row. They
+// are left out of cookie sessions, which carry only their own expiry.
+var rowMetaKeys = []string{"created", "expires", "modified", "stale", "digest", "inserted"}
+
+// saveToCookie stores the values of session in its cookie if they serialize
+// to no more than Options.CookieThreshold bytes, removing the database row
+// the session may have had. It reports false if the session has to be
+// stored in the database.
+func (m *SQLStore) saveToCookie(r requestContext, session *sessions.Session) (bool, error) {
+	if err := m.removeReplaced(r.Context(), session); err != nil {
+		return false, err
+	}
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		values[k] = v
+	}
+	for _, key := range rowMetaKeys {
+		delete(values, m.keyPrefix+key)
+	}
+	values[m.keyPrefix+"expires"] = m.stamp(m.clock.Now()) + m.seconds(m.lifetime(r.CookieMaxAge(), session))
+	encoded, release, err := m.encodeValues(values)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	if len(encoded) > m.cookieLimit {
+		return false, nil
+	}
+	value, err := m.encodeCookie(session.Name(), cookieMarker+string(encoded))
+	if err != nil {
+		return false, err
+	}
+	if len(session.ID) > 0 {
+		if err = m.removeResolved(r.Context(), session.ID); err != nil {
+			return false, err
+		}
+		session.ID = ``
+	}
+	r.SetCookie(session.Name(), value)
+	return true, nil
+}
+
+// loadFromCookie restores the values of a session stored in its cookie by
+// saveToCookie, unless it expired. It reports false if decoded is a session
+// ID.
+func (m *SQLStore) loadFromCookie(ctx context.Context, session *sessions.Session, decoded string) (bool, error) {
+	if !strings.HasPrefix(decoded, cookieMarker) {
+		return false, nil
+	}
+	values := map[interface{}]interface{}{}
+	if err := m.decodeValues([]byte(decoded[len(cookieMarker):]), &values); err != nil {
+		return true, err
+	}
+	expires, _ := values[m.keyPrefix+"expires"].(int64)
+	if now := m.clock.Now(); expires < m.stamp(now.Add(-m.clockSkew)) {
+		m.logf(ctx, "Session expired on %s, but it is %s now.", m.fromStamp(expires), now)
+		if m.expiredErr {
+			return true, ErrSessionExpired
+		}
+		return true, nil
+	}
+	delete(values, m.keyPrefix+"expires")
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	m.purgeExpiredValues(session)
+	session.IsNew = false
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package sqlstore_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/admpub/securecookie"
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestCookieThresholdSpillsLargeSessions(t *testing.T) {
+	keys := [][]byte{securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32)}
+	s := sqlstoretest.New(t, &sqlstore.Options{KeyPairs: keys, CookieThreshold: 256})
+	rows := func() (n int) {
+		if err := s.DB.QueryRow(`SELECT COUNT(*) FROM session`).Scan(&n); err != nil {
+			t.Fatalf(`count rows: %v`, err)
+		}
+		return n
+	}
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if n := rows(); n != 0 {
+		t.Fatalf(`a small session wrote %d rows, want it in the cookie`, n)
+	}
+
+	r, session = c.get()
+	if session.IsNew || session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v (new: %v) from the cookie, want user alice`, session.Values, session.IsNew)
+	}
+	session.Values[`bio`] = strings.Repeat(`x`, 512)
+	c.save(r, session)
+	if n := rows(); n != 1 {
+		t.Fatalf(`a large session wrote %d rows, want 1`, n)
+	}
+
+	r, session = c.get()
+	if session.IsNew || session.Values[`user`] != `alice` || len(session.ID) == 0 {
+		t.Fatalf(`loaded %v (new: %v, id %q) after spilling, want the stored row`, session.Values, session.IsNew, session.ID)
+	}
+	// Shrinking the session moves it back into the cookie.
+	delete(session.Values, `bio`)
+	c.save(r, session)
+	if n := rows(); n != 0 {
+		t.Fatalf(`a shrunk session left %d rows`, n)
+	}
+	if _, session = c.get(); session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v from the cookie again, want user alice`, session.Values)
+	}
+}
+
+func TestCookieSessionsRequireBlockKeys(t *testing.T) {
+	db, err := sql.Open(`sqlite3`, `file:hybridkeys?mode=memory&cache=shared`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cfg := &sqlstore.Options{Dialect: sqlstore.SQLite, CookieThreshold: 256,
+		KeyPairs: [][]byte{securecookie.GenerateRandomKey(32)}}
+	cfg.SetDDL(sqlstoretest.DDL)
+	if s, err := sqlstore.New(db, cfg); err == nil {
+		s.Close()
+		t.Fatal(`New accepted CookieThreshold with a hash key only`)
+	}
+}
+
+func TestCookieSessionsExpire(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	keys := [][]byte{securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32)}
+	s := sqlstoretest.New(t, &sqlstore.Options{KeyPairs: keys, CookieThreshold: 256, MaxAge: 3600, Clock: clock})
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+
+	// The cookie session carries no meta values of an earlier row.
+	r, session = c.get()
+	if session.IsNew || len(session.Values) != 1 {
+		t.Fatalf(`loaded %v (new: %v) from the cookie, want only user alice`, session.Values, session.IsNew)
+	}
+	now = now.Add(30 * time.Minute)
+	c.save(r, session)
+	now = now.Add(45 * time.Minute)
+	if _, session = c.get(); session.IsNew {
+		t.Fatal(`saving the cookie session did not extend it`)
+	}
+
+	// Growing into the database starts the row's lifetime now.
+	r, session = c.get()
+	session.Values[`bio`] = strings.Repeat(`x`, 512)
+	c.save(r, session)
+	_, expires, ok := s.Lookup(session.ID)
+	if !ok || expires.Before(now.Add(59*time.Minute)) {
+		t.Fatalf(`the spilled row expires at %v (found %v), want an hour after %v`, expires, ok, now)
+	}
+	r, session = c.get()
+	delete(session.Values, `bio`)
+	c.save(r, session)
+
+	now = now.Add(2 * time.Hour)
+	if _, session = c.get(); !session.IsNew || len(session.Values) != 0 {
+		t.Fatalf(`loaded %v (new: %v) after MaxAge, want a new session`, session.Values, session.IsNew)
+	}
+}
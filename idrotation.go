@@ -0,0 +1,55 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// RotateIDsBefore makes every session whose ID was issued before t get a new
+// ID and cookie the next time it is loaded and saved, rotating the IDs of
+// all clients after a compromise without logging anyone out. Sessions
+// issued before IDs were tracked count from their creation. The zero time
+// stops the rotation. Sessions under Options.SharedCookie are not rotated.
+func (m *SQLStore) RotateIDsBefore(t time.Time) {
+	if t.IsZero() {
+		m.rotateBefore.Store(0)
+		return
+	}
+	m.rotateBefore.Store(m.stamp(t))
+}
+
+// issueID records when session was given its current ID.
+func (m *SQLStore) issueID(session *sessions.Session) {
+	session.Values[m.keyPrefix+"issued"] = m.stamp(m.clock.Now())
+}
+
+// markIDRotation clears the ID of a loaded session issued before the time
+// set with RotateIDsBefore, so its next save stores it under a new ID and
+// removes the old row.
+func (m *SQLStore) markIDRotation(session *sessions.Session) {
+	before := m.rotateBefore.Load()
+	if before == 0 || len(m.sharedCookie) > 0 {
+		return
+	}
+	issued, ok := session.Values[m.keyPrefix+"issued"].(int64)
+	if !ok {
+		issued, _ = session.Values[m.keyPrefix+"created"].(int64)
+	}
+	if issued >= before {
+		return
+	}
+	session.Values[m.keyPrefix+"replaces"] = session.ID
+	session.ID = ``
+}
+
+// removeReplaced removes the row of the ID replaced by markIDRotation.
+func (m *SQLStore) removeReplaced(ctx context.Context, session *sessions.Session) error {
+	oldID, ok := session.Values[m.keyPrefix+"replaces"].(string)
+	if !ok {
+		return nil
+	}
+	delete(session.Values, m.keyPrefix+"replaces")
+	return m.removeResolved(ctx, oldID)
+}
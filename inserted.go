@@ -0,0 +1,49 @@
+package sqlstore
+
+import (
+	"github.com/admpub/sessions"
+)
+
+// Inserted reports whether the last save of session created its row, as
+// opposed to updating an existing one, e.g. to count new visitors. It is
+// false before the first save. On MySQL and its relatives, it requires a
+// connection without the CLIENT_FOUND_ROWS flag (clientFoundRows=true).
+func (m *SQLStore) Inserted(session *sessions.Session) bool {
+	inserted, _ := session.Values[m.keyPrefix+"inserted"].(bool)
+	return inserted
+}
+
+// insertRow runs the insert statement of st and reports whether it created
+// the row rather than updating an existing one with the same ID. MySQL and
+// its relatives report 1 affected row for an insert, 2 for an update and 0
+// for an update changing nothing; with the CLIENT_FOUND_ROWS flag
+// (clientFoundRows=true in the DSN) the latter is 1 and taken for an
+// insert. Postgres returns whether the row is new. Other databases and
+// procedures are assumed to insert. The plain INSERT of Options.Galera is
+// used for generated IDs.
+func (m *SQLStore) insertRow(st *statements, args []interface{}, generated bool) (bool, error) {
+	if generated && st.create != nil {
+		_, err := m.execStmt(st, st.create, args...)
+		return err == nil, err
+	}
+	if m.dialect == Postgres && m.procs == nil {
+		var inserted bool
+		scan := func() error {
+			return st.insert.QueryRow(args...).Scan(&inserted)
+		}
+		if st.tx {
+			return inserted, scan()
+		}
+		err := m.writeRetried(scan)
+		return inserted, err
+	}
+	result, err := m.execStmt(st, st.insert, args...)
+	if err != nil || m.procs != nil || m.dialect == SQLite {
+		return err == nil, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,34 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/admpub/errors"
+)
+
+var ErrNoInstanceColumn = errors.New("sqlstore: Options.InstanceColumn is not set")
+
+// ListByInstance lists the sessions created by the instance instanceID,
+// ordered by creation time and ID. It requires Options.InstanceColumn.
+func (m *SQLStore) ListByInstance(ctx context.Context, instanceID string, page Page) ([]SessionInfo, error) {
+	if !m.instanceCol {
+		return nil, ErrNoInstanceColumn
+	}
+	return m.listTables(ctx, func(table string) string {
+		return "SELECT id, created, modified, expires FROM " + table +
+			" WHERE instance = ?" + m.notDeleted() + " ORDER BY created, id"
+	}, []interface{}{instanceID}, page, func(a, b *SessionInfo) bool {
+		return a.Created.Before(b.Created) || a.Created.Equal(b.Created) && a.ID < b.ID
+	})
+}
+
+// CountByInstance returns the number of stored sessions created by the
+// instance instanceID. It requires Options.InstanceColumn.
+func (m *SQLStore) CountByInstance(ctx context.Context, instanceID string) (int64, error) {
+	if !m.instanceCol {
+		return 0, ErrNoInstanceColumn
+	}
+	return m.countTables(ctx, func(table string) string {
+		return "SELECT COUNT(*) FROM " + table + " WHERE instance = ?" + m.notDeleted()
+	}, instanceID)
+}
@@ -0,0 +1,47 @@
+package sqlstore
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/securecookie"
+)
+
+var ErrRetiredKey = errors.New("Session cookie signed with a retired key")
+
+// keyTagSep separates the key generation tag from the encoded cookie, whose
+// URL-safe base64 alphabet does not contain it.
+const keyTagSep = `.`
+
+// encodeCookie encodes value with the current codec, prefixed with its key
+// generation if Options.KeyGeneration is set.
+func (m *SQLStore) encodeCookie(name string, value string) (string, error) {
+	encoded, err := securecookie.EncodeMulti(name, value, m.Codecs...)
+	if err != nil || m.keyGen <= 0 {
+		return encoded, err
+	}
+	return strconv.Itoa(m.keyGen) + keyTagSep + encoded, nil
+}
+
+// decodeCookie decodes a cookie value into dst. A tagged value is decoded
+// with the codec of its key generation only, and fails with ErrRetiredKey
+// if that generation is no longer configured; untagged values try every
+// codec.
+func (m *SQLStore) decodeCookie(name string, value string, dst *string) error {
+	tag, encoded, tagged := strings.Cut(value, keyTagSep)
+	if !tagged {
+		return securecookie.DecodeMulti(name, value, dst, m.Codecs...)
+	}
+	gen, err := strconv.Atoi(tag)
+	if err != nil {
+		return err
+	}
+	// The first codec is the current generation, each following one the
+	// generation before.
+	i := m.keyGen - gen
+	if i < 0 || i >= len(m.Codecs) {
+		return ErrRetiredKey
+	}
+	return m.Codecs[i].Decode(name, encoded, dst)
+}
@@ -0,0 +1,111 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// LifetimeBuckets are the upper bounds of the session lifetime histograms.
+// A final bucket counts longer lifetimes.
+var LifetimeBuckets = [...]time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+}
+
+// Lifetimes is a histogram of session lifetimes over LifetimeBuckets.
+type Lifetimes [len(LifetimeBuckets) + 1]int64
+
+// lifetimeBucket returns the histogram bucket of lifetime d.
+func lifetimeBucket(d time.Duration) int {
+	for i, upper := range LifetimeBuckets {
+		if d <= upper {
+			return i
+		}
+	}
+	return len(LifetimeBuckets)
+}
+
+// observeLifetime records the lifetime of a session that ended.
+func (m *SQLStore) observeLifetime(d time.Duration) {
+	m.stats.lifetimes[lifetimeBucket(d)].Add(1)
+}
+
+// observeDeleted records the lifetime of session, which is being deleted.
+func (m *SQLStore) observeDeleted(session *sessions.Session) {
+	if created, ok := m.CreatedAt(session); ok {
+		m.observeLifetime(m.clock.Now().Sub(created))
+	}
+}
+
+// observeExpired records the lifetimes of the sessions that expired before
+// cutoff, ahead of their removal by GC.
+func (m *SQLStore) observeExpired(cutoff int64) error {
+	tables, err := m.sessionTables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err = m.observeExpiredIn(table, cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeExpiredIn is observeExpired for the sessions of table.
+func (m *SQLStore) observeExpiredIn(table string, cutoff int64) error {
+	rows, err := m.query(context.Background(), "SELECT created, expires FROM "+table+" WHERE expires < ?"+m.notDeleted(), m.dbStamp(cutoff))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var created, expires unixTime
+		if err = rows.Scan(&created, &expires); err != nil {
+			return err
+		}
+		m.observeLifetime(m.fromStamp(expires.ts).Sub(m.fromStamp(created.ts)))
+	}
+	return rows.Err()
+}
+
+// LifetimeStats returns a histogram of how long the sessions in the tables
+// have been in use so far, from creation to their last save.
+func (m *SQLStore) LifetimeStats(ctx context.Context) (Lifetimes, error) {
+	var h Lifetimes
+	tables, err := m.sessionTables()
+	if err != nil {
+		return h, err
+	}
+	for _, table := range tables {
+		if err = m.lifetimesIn(ctx, table, &h); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// lifetimesIn adds the lifetimes of the sessions of table to h.
+func (m *SQLStore) lifetimesIn(ctx context.Context, table string, h *Lifetimes) error {
+	rows, err := m.query(ctx, "SELECT created, modified FROM "+table+" WHERE 1 = 1"+m.notDeleted())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var created, modified unixTime
+		if err = rows.Scan(&created, &modified); err != nil {
+			return err
+		}
+		h[lifetimeBucket(m.fromStamp(modified.ts).Sub(m.fromStamp(created.ts)))]++
+	}
+	return rows.Err()
+}
@@ -0,0 +1,83 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/admpub/errors"
+)
+
+// Time columns that ListByTimeRange can filter on.
+const (
+	FieldCreated  = `created`
+	FieldModified = `modified`
+	FieldExpires  = `expires`
+)
+
+// DefaultPageLimit is the page size used when Page.Limit is not set.
+var DefaultPageLimit = 100
+
+var ErrInvalidField = errors.New("sqlstore: invalid time field")
+
+// Page selects a slice of a listing.
+type Page struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// SessionInfo describes a listed session without its values.
+type SessionInfo struct {
+	ID       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	Expires  time.Time `json:"expires"`
+}
+
+// ListByTimeRange lists the sessions whose field, one of FieldCreated,
+// FieldModified or FieldExpires, is in [from, to), ordered by field and ID,
+// e.g. to find the sessions created during an incident. Expired sessions
+// not yet removed by GC are included.
+func (m *SQLStore) ListByTimeRange(ctx context.Context, field string, from, to time.Time, page Page) ([]SessionInfo, error) {
+	switch field {
+	case FieldCreated, FieldModified, FieldExpires:
+	default:
+		return nil, ErrInvalidField
+	}
+	return m.listTables(ctx, func(table string) string {
+		return "SELECT id, created, modified, expires FROM " + table +
+			" WHERE " + field + " >= ? AND " + field + " < ?" + m.notDeleted() + " ORDER BY " + field + ", id"
+	}, []interface{}{m.dbTime(from), m.dbTime(to)}, page, func(a, b *SessionInfo) bool {
+		ta, tb := a.field(field), b.field(field)
+		return ta.Before(tb) || ta.Equal(tb) && a.ID < b.ID
+	})
+}
+
+// field returns the time of info named by one of the Field constants.
+func (info *SessionInfo) field(name string) time.Time {
+	switch name {
+	case FieldCreated:
+		return info.Created
+	case FieldModified:
+		return info.Modified
+	}
+	return info.Expires
+}
+
+// scanSessionInfos reads and closes rows of id, created, modified and
+// expires.
+func (m *SQLStore) scanSessionInfos(rows *limitedRows) ([]SessionInfo, error) {
+	defer rows.Close()
+	var list []SessionInfo
+	for rows.Next() {
+		var info SessionInfo
+		var created, modified, expires unixTime
+		if err := rows.Scan(&info.ID, &created, &modified, &expires); err != nil {
+			return nil, err
+		}
+		info.Created = m.fromStamp(created.ts)
+		info.Modified = m.fromStamp(modified.ts)
+		info.Expires = m.fromStamp(expires.ts)
+		list = append(list, info)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,65 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/admpub/sessions"
+)
+
+// LoadMulti loads the sessions with the given IDs in a single query, for
+// batch jobs and admin tools. The returned sessions are unnamed and keyed by
+// ID; IDs without a live session are left out.
+func (m *SQLStore) LoadMulti(ctx context.Context, ids []string) (map[string]*sessions.Session, error) {
+	result := make(map[string]*sessions.Session, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	if err := m.begin(); err != nil {
+		return nil, err
+	}
+	defer m.end()
+	st, err := m.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.release(st)
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := m.query(ctx, "SELECT "+strings.Join(m.selCols, ", ")+" FROM "+st.table+
+		" WHERE id IN ("+placeholders(len(ids))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	var found []Row
+	for rows.Next() {
+		sess := Row{}
+		if err = m.rowMapper(rows, m.selCols, &sess); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found = append(found, sess)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// Rows are decoded once the result is closed, as loading may run
+	// queries of its own.
+	for i := range found {
+		sess := &found[i]
+		session := sessions.NewSession(m, ``)
+		session.ID = sess.ID
+		if err = m.loadRow(ctx, st, session, sess); err != nil {
+			if err != sql.ErrNoRows && err != ErrSessionExpired {
+				m.reportErrorCtx(ctx, OpLoad, sess.ID, err)
+			}
+			continue
+		}
+		result[sess.ID] = session
+	}
+	return result, nil
+}
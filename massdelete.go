@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// MassDeletion describes an operation that deleted or invalidated more
+// sessions than Options.MassDeleteThreshold.
+type MassDeletion struct {
+	// Op is OpGC for a cleanup pass, or the name of the method, e.g.
+	// "DestroyAllForOwner".
+	Op       string    `json:"op"`
+	Sessions int64     `json:"sessions"`
+	Time     time.Time `json:"time"`
+
+	logf func(format string, args ...interface{}) // the store's logger
+}
+
+// checkMassDelete calls Options.OnMassDelete if op affected more sessions
+// than a positive threshold.
+func (m *SQLStore) checkMassDelete(op string, n int64) {
+	if m.onMassDelete == nil || m.massDelete <= 0 || n <= m.massDelete {
+		return
+	}
+	m.onMassDelete(MassDeletion{Op: op, Sessions: n, Time: m.clock.Now(), logf: func(format string, args ...interface{}) {
+		m.logf(context.Background(), format, args...)
+	}})
+}
+
+// MassDeleteWebhook returns an Options.OnMassDelete hook that posts each
+// MassDeletion as JSON to url in the background. Failures are logged by the
+// store that reported the deletion.
+func MassDeleteWebhook(url string) func(MassDeletion) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(d MassDeletion) {
+		logf := d.logf
+		if logf == nil {
+			logf = func(format string, args ...interface{}) { logTrace(``, format, args...) }
+		}
+		body, err := json.Marshal(d)
+		if err != nil {
+			logf("unable to encode mass deletion: %v", err)
+			return
+		}
+		go func() {
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				logf("mass deletion webhook failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				logf("mass deletion webhook returned %s", resp.Status)
+			}
+		}()
+	}
+}
@@ -0,0 +1,145 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/admpub/errors"
+)
+
+// DefaultMigrateBatch is the number of sessions MigrateTable copies at a time
+// when MigrateOptions.BatchSize is not set.
+var DefaultMigrateBatch = 500
+
+var ErrMigrating = errors.New("sqlstore: a table migration is already running")
+
+// MigrateOptions configures MigrateTable.
+type MigrateOptions struct {
+	// BatchSize is the number of sessions copied per statement, default
+	// DefaultMigrateBatch.
+	BatchSize int
+	// Progress, if set, is called after each batch with the number of
+	// sessions copied so far and the number of rows in the old table when
+	// the backfill started.
+	Progress func(copied, total int64)
+}
+
+// MigrateTable moves the store to a new session table without downtime:
+// it creates table with ddl, in which %s is replaced by the quoted table
+// name, mirrors every session write into it, backfills the existing
+// sessions in batches and then switches reads and writes to it with
+// SwitchTable. The old table is left in place for the caller to drop.
+//
+// The columns the store uses are copied; the new table may add others with
+// defaults. Bulk helpers such as DestroyAllForOwner are not mirrored while
+// the migration runs. It is not supported with Options.TableResolver,
+// Options.Rotation or Options.Procedures.
+func (m *SQLStore) MigrateTable(ctx context.Context, table string, ddl string, opts MigrateOptions) error {
+	if m.resolveTable != nil || m.procs != nil {
+		return errors.New("sqlstore: MigrateTable cannot be used with TableResolver, Rotation or Procedures")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultMigrateBatch
+	}
+	to := m.dialect.Quote(table)
+	if _, err := m.execRaw(ctx, fmt.Sprintf(ddl, to)); err != nil {
+		return err
+	}
+	if !m.mirror.CompareAndSwap(nil, &to) {
+		return ErrMigrating
+	}
+	defer m.mirror.Store(nil)
+	from := m.tableName()
+	var total int64
+	if err := m.queryRow(ctx, "SELECT COUNT(*) FROM "+from).Scan(&total); err != nil {
+		return err
+	}
+	var copied int64
+	var last string
+	for {
+		ids, err := m.nextIDs(ctx, from, last, opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err = m.copyRows(ctx, from, to, ids); err != nil {
+			return err
+		}
+		last = ids[len(ids)-1]
+		copied += int64(len(ids))
+		if opts.Progress != nil {
+			opts.Progress(copied, total)
+		}
+	}
+	// Writes still running on the old statements keep being mirrored until
+	// the deferred reset.
+	return m.SwitchTable(ctx, table)
+}
+
+// nextIDs returns up to n IDs of table following after, in order.
+func (m *SQLStore) nextIDs(ctx context.Context, table string, after string, n int) ([]string, error) {
+	rows, err := m.query(ctx, "SELECT id FROM "+table+" WHERE id > ? ORDER BY id LIMIT ?", after, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0, n)
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// copyColumns returns the columns the store reads or writes.
+func (m *SQLStore) copyColumns() string {
+	cols := append([]string{}, m.insCols...)
+	for _, col := range m.selCols {
+		var found bool
+		for _, c := range cols {
+			if c == col {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cols = append(cols, col)
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// copyRows replaces the rows of ids in table to with those in table from,
+// removing the ones from does not have.
+func (m *SQLStore) copyRows(ctx context.Context, from string, to string, ids []string) error {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	in := " WHERE id IN (" + placeholders(len(ids)) + ")"
+	cols := m.copyColumns()
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.dialect.rebind("DELETE FROM "+to+in), args...); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, m.dialect.rebind("INSERT INTO "+to+" ("+cols+") SELECT "+cols+" FROM "+from+in), args...)
+		return err
+	})
+}
+
+// mirrorRow copies the row of sessionID from the table of st into the
+// table being migrated to, if any.
+func (m *SQLStore) mirrorRow(ctx context.Context, st *statements, sessionID string) error {
+	to := m.mirror.Load()
+	if to == nil || *to == st.table {
+		return nil
+	}
+	return m.copyRows(ctx, st.table, *to, []string{sessionID})
+}
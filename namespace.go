@@ -0,0 +1,49 @@
+package sqlstore
+
+import (
+	"strings"
+)
+
+// namespaceSep separates the client ID from the session name in the row ID
+// of a shared-cookie session. Generated IDs are base32 and never contain it.
+const namespaceSep = `/`
+
+// cookieName returns the cookie carrying the session named name.
+func (m *SQLStore) cookieName(name string) string {
+	if len(m.sharedCookie) > 0 {
+		return m.sharedCookie
+	}
+	return name
+}
+
+// rowID returns the ID of the row of the session named name whose cookie
+// decoded to id.
+func (m *SQLStore) rowID(id string, name string) string {
+	if len(m.sharedCookie) == 0 {
+		return id
+	}
+	return id + namespaceSep + name
+}
+
+// clientID returns the part of a row ID stored in the cookie.
+func (m *SQLStore) clientID(rowID string) string {
+	if len(m.sharedCookie) == 0 {
+		return rowID
+	}
+	id, _, _ := strings.Cut(rowID, namespaceSep)
+	return id
+}
+
+// issuedClient returns the client ID of the shared cookie set while handling
+// r, so sessions first saved in the same request share it.
+func (m *SQLStore) issuedClient(r requestContext) string {
+	value := r.IssuedCookie(m.sharedCookie)
+	if len(value) == 0 {
+		return ``
+	}
+	var id string
+	if err := m.decodeCookie(m.sharedCookie, value, &id); err != nil {
+		return ``
+	}
+	return id
+}
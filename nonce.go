@@ -0,0 +1,98 @@
+package sqlstore
+
+import (
+	"encoding/base32"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/securecookie"
+	"github.com/admpub/sessions"
+)
+
+// DefaultNonceTolerance is how long a replaced cookie nonce of a session
+// stays valid when Options.NonceTolerance is not set.
+var DefaultNonceTolerance = 30 * time.Second
+
+var ErrReplayedCookie = errors.New("Session cookie replayed")
+
+// nonceSep separates the session ID from the nonce in the cookie. Neither
+// base32 IDs nor namespaces contain it.
+const nonceSep = `~`
+
+// splitNonce splits a decoded cookie value into the session ID and nonce.
+func splitNonce(value string) (string, string) {
+	id, nonce, _ := strings.Cut(value, nonceSep)
+	return id, nonce
+}
+
+// rotateNonce gives session a new nonce and returns it. Every nonce it
+// replaces stays valid for Options.NonceTolerance after the replacement, so
+// any number of concurrent requests or saves within the window succeed.
+func (m *SQLStore) rotateNonce(session *sessions.Session) string {
+	now := m.clock.Now()
+	recent := m.recentNonces(session, now)
+	if prev, ok := session.Values[m.keyPrefix+"nonce"].(string); ok {
+		recent = append(recent, prev+nonceStampSep+strconv.FormatInt(m.stamp(now), 10))
+	}
+	if len(recent) > 0 {
+		session.Values[m.keyPrefix+"prevNonce"] = strings.Join(recent, ",")
+	}
+	delete(session.Values, m.keyPrefix+"nonceAt")
+	nonce := strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(10)), "=")
+	session.Values[m.keyPrefix+"nonce"] = nonce
+	return nonce
+}
+
+// nonceStampSep separates a replaced nonce from the stamp of its
+// replacement. Base32 nonces do not contain it.
+const nonceStampSep = `@`
+
+// recentNonces returns the replaced nonces of session that are still within
+// the tolerance window at now, each followed by the stamp of its
+// replacement. Sessions saved before the stamps were kept hold a single
+// nonce replaced at nonceAt.
+func (m *SQLStore) recentNonces(session *sessions.Session, now time.Time) []string {
+	list, _ := session.Values[m.keyPrefix+"prevNonce"].(string)
+	var recent []string
+	for _, entry := range strings.Split(list, ",") {
+		nonce, ts, found := strings.Cut(entry, nonceStampSep)
+		if len(nonce) == 0 {
+			continue
+		}
+		var replaced time.Time
+		if found {
+			n, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				continue
+			}
+			replaced = m.fromStamp(n)
+		} else {
+			replaced, _ = m.metaTime(session.Values[m.keyPrefix+"nonceAt"])
+		}
+		if replaced.Add(m.nonceWindow).After(now) {
+			recent = append(recent, nonce+nonceStampSep+strconv.FormatInt(m.stamp(replaced), 10))
+		}
+	}
+	return recent
+}
+
+// checkNonce verifies the nonce presented with the cookie of a loaded
+// session: it must be the current one, or one replaced within the tolerance
+// window, so that concurrent requests are not rejected. Sessions saved
+// before nonces were enabled are accepted.
+func (m *SQLStore) checkNonce(session *sessions.Session, nonce string) error {
+	current, ok := session.Values[m.keyPrefix+"nonce"].(string)
+	if !ok || nonce == current {
+		return nil
+	}
+	if len(nonce) > 0 {
+		for _, entry := range m.recentNonces(session, m.clock.Now()) {
+			if prev, _, _ := strings.Cut(entry, nonceStampSep); prev == nonce {
+				return nil
+			}
+		}
+	}
+	return ErrReplayedCookie
+}
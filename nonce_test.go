@@ -0,0 +1,34 @@
+package sqlstore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestCookieNonceToleratesConcurrentSaves(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{CookieNonce: true, NonceTolerance: time.Minute, Clock: clock})
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	c.save(r, session)
+
+	// Three more saves with the first cookie, as concurrent requests would.
+	for i := 0; i < 3; i++ {
+		tab := c.clone()
+		r, session = tab.get()
+		if session.IsNew {
+			t.Fatalf(`Get %d with the first cookie returned a new session`, i)
+		}
+		tab.save(r, session)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := c.h.Get(c.request(), `SID`); !errors.Is(err, sqlstore.ErrReplayedCookie) {
+		t.Fatalf(`Get after the tolerance window: err %v, want ErrReplayedCookie`, err)
+	}
+}
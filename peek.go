@@ -0,0 +1,49 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// Meta is the metadata of a stored session.
+type Meta struct {
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	Expires  time.Time `json:"expires"`
+	Flags    Flags     `json:"flags"`
+}
+
+// Peek loads and decodes the session sessionID outside of a request, for
+// background jobs and admin tools. Keys are converted to strings. It fails
+// with sql.ErrNoRows for an unknown session and with ErrSessionExpired for
+// an expired one.
+func (m *SQLStore) Peek(ctx context.Context, sessionID string) (map[string]interface{}, Meta, error) {
+	var meta Meta
+	st, err := m.acquire(ctx)
+	if err != nil {
+		return nil, meta, err
+	}
+	defer m.release(st)
+	session := sessions.NewSession(m, ``)
+	session.ID = sessionID
+	if err = m.load(ctx, st, session); err != nil {
+		return nil, meta, err
+	}
+	meta.Created, _ = m.CreatedAt(session)
+	meta.Modified, _ = m.ModifiedAt(session)
+	meta.Expires, _ = m.ExpiresAt(session)
+	meta.Flags = m.Flags(session)
+	values := make(map[string]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		key := fmt.Sprint(k)
+		if strings.HasPrefix(key, m.keyPrefix) {
+			continue
+		}
+		values[key] = v
+	}
+	return values, meta, nil
+}
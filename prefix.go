@@ -0,0 +1,35 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/admpub/errors"
+)
+
+// likeEscaper escapes the LIKE wildcards of a literal, with ! as the escape
+// character, which every supported database accepts.
+var likeEscaper = strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+
+// RemoveByPrefix removes every session whose ID starts with prefix, for
+// deployments that encode a tenant or shard into their session IDs. It
+// returns the number of removed sessions.
+func (m *SQLStore) RemoveByPrefix(ctx context.Context, prefix string) (int64, error) {
+	if len(prefix) == 0 {
+		return 0, errors.New("sqlstore: RemoveByPrefix requires a prefix")
+	}
+	if m.readOnly.Load() {
+		return 0, ErrReadOnly
+	}
+	cond := " WHERE id LIKE ? ESCAPE '!'"
+	pattern := likeEscaper.Replace(prefix) + `%`
+	query := func(table string) string { return "DELETE FROM " + table + cond }
+	args := []interface{}{pattern}
+	if m.softDelete {
+		query = func(table string) string { return "UPDATE " + table + " SET deleted_at = ?" + cond + m.notDeleted() }
+		args = []interface{}{m.clock.Now().Unix(), pattern}
+	}
+	n, err := m.execTables(ctx, query, args...)
+	m.checkMassDelete("RemoveByPrefix", n)
+	return n, err
+}
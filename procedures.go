@@ -0,0 +1,69 @@
+package sqlstore
+
+import (
+	"github.com/admpub/errors"
+)
+
+// Procedures names the stored procedures the store calls instead of running
+// inline SQL, for databases where the application may only EXECUTE. The
+// store's own reads, writes, deletes and GC go through them; helpers such
+// as TTL or FindByToken still run inline SQL.
+type Procedures struct {
+	// Get is called with the session ID and returns at most one row with
+	// the columns id, data, created, modified and expires, followed by
+	// checksum and flags when enabled. On Postgres it must be a function.
+	Get string `json:"get"`
+	// Put is called with id, data, created, modified and expires, followed
+	// by expires_at, checksum, flags and the promoted columns as enabled,
+	// and inserts or replaces the row.
+	Put string `json:"put"`
+	// Delete is called with the session ID.
+	Delete string `json:"delete"`
+	// GC is called with a time in Options.TimeFormat and deletes the
+	// sessions that expired before it.
+	GC string `json:"gc"`
+}
+
+func (p *Procedures) validate(o *Options) error {
+	if len(p.Get) == 0 || len(p.Put) == 0 || len(p.Delete) == 0 || len(p.GC) == 0 {
+		return errors.New("sqlstore: Procedures requires Get, Put, Delete and GC")
+	}
+	if o.SoftDelete || o.SecureDelete || o.LastWriterWins || o.Enrich != nil || o.InstanceColumn ||
+		o.TableResolver != nil || len(o.Rotation) > 0 {
+		return errors.New("sqlstore: Procedures cannot be combined with SoftDelete, SecureDelete, LastWriterWins, Enrich, InstanceColumn, TableResolver or Rotation")
+	}
+	return nil
+}
+
+// call returns the statement calling procedure with n arguments.
+func (m *SQLStore) call(procedure string, n int) string {
+	return m.dialect.rebind("CALL " + procedure + "(" + placeholders(n) + ")")
+}
+
+// prepareProcedures prepares the statements of st as procedure calls.
+func (m *SQLStore) prepareProcedures(st *statements) (*statements, error) {
+	var err error
+	putQ := m.call(m.procs.Put, len(m.insCols))
+	if st.insert, err = m.prepareStmt(putQ); err != nil {
+		return nil, errors.Wrap(err, putQ)
+	}
+	// Updates pass the same arguments as inserts, see save.
+	if st.update, err = m.prepareStmt(putQ); err != nil {
+		st.close()
+		return nil, errors.Wrap(err, putQ)
+	}
+	delQ := m.call(m.procs.Delete, 1)
+	if st.delete, err = m.prepareStmt(delQ); err != nil {
+		st.close()
+		return nil, errors.Wrap(err, delQ)
+	}
+	getQ := m.call(m.procs.Get, 1)
+	if m.dialect == Postgres {
+		getQ = m.dialect.rebind("SELECT * FROM " + m.procs.Get + "(?)")
+	}
+	if st.selectRow, err = m.prepareStmt(getQ); err != nil {
+		st.close()
+		return nil, errors.Wrap(err, getQ)
+	}
+	return st, nil
+}
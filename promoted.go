@@ -0,0 +1,142 @@
+package sqlstore
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/sessions"
+)
+
+var ErrNoOwnerKey = errors.New("sqlstore: Options.OwnerKey is not set")
+
+type promotedColumn struct {
+	key    string
+	column string
+}
+
+// promoted returns the promoted columns, including the token column, in a
+// stable order.
+func (o *Options) promoted() []promotedColumn {
+	cols := make([]promotedColumn, 0, len(o.PromotedColumns)+1)
+	for key, column := range o.PromotedColumns {
+		cols = append(cols, promotedColumn{key: key, column: column})
+	}
+	if len(o.TokenKey) > 0 {
+		cols = append(cols, promotedColumn{key: o.TokenKey, column: "token"})
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].column < cols[j].column
+	})
+	return cols
+}
+
+// appendPromoted appends the values of the promoted keys of session to args.
+// Missing values are stored as NULL.
+func (m *SQLStore) appendPromoted(args []interface{}, session *sessions.Session) []interface{} {
+	for _, p := range m.promoted {
+		args = append(args, session.Values[p.key])
+	}
+	return args
+}
+
+// DestroyAllForOwner removes every session whose owner column, configured
+// with Options.OwnerKey, equals owner, e.g. to log a user out everywhere. It
+// returns the number of affected sessions.
+func (m *SQLStore) DestroyAllForOwner(ctx context.Context, owner interface{}) (int64, error) {
+	if len(m.ownerColumn) == 0 {
+		return 0, ErrNoOwnerKey
+	}
+	if m.readOnly.Load() {
+		return 0, ErrReadOnly
+	}
+	query := func(table string) string {
+		return "DELETE FROM " + table + " WHERE " + m.ownerColumn + " = ?"
+	}
+	args := []interface{}{owner}
+	if m.softDelete {
+		query = func(table string) string {
+			return "UPDATE " + table + " SET deleted_at = ? WHERE " + m.ownerColumn + " = ?" + m.notDeleted()
+		}
+		args = []interface{}{m.clock.Now().Unix(), owner}
+	}
+	n, err := m.execTables(ctx, query, args...)
+	m.checkMassDelete("DestroyAllForOwner", n)
+	return n, err
+}
+
+// OwnerCount is the number of live sessions of an owner.
+type OwnerCount struct {
+	Owner    interface{} `json:"owner"`
+	Sessions int64       `json:"sessions"`
+}
+
+// CountByOwner returns the number of unexpired sessions of owner, see
+// Options.OwnerKey.
+func (m *SQLStore) CountByOwner(ctx context.Context, owner interface{}) (int64, error) {
+	if len(m.ownerColumn) == 0 {
+		return 0, ErrNoOwnerKey
+	}
+	return m.countTables(ctx, func(table string) string {
+		return "SELECT COUNT(*) FROM " + table + " WHERE " + m.ownerColumn + " = ? AND expires >= ?" + m.notDeleted()
+	}, owner, m.dbTime(m.clock.Now()))
+}
+
+// TopOwners returns the n owners with the most unexpired sessions, most
+// first, e.g. to find accounts with abnormally many concurrent sessions.
+// Sessions without an owner are not counted. n must be positive.
+func (m *SQLStore) TopOwners(ctx context.Context, n int) ([]OwnerCount, error) {
+	if len(m.ownerColumn) == 0 {
+		return nil, ErrNoOwnerKey
+	}
+	if n <= 0 {
+		return nil, errors.New("sqlstore: TopOwners requires a positive n")
+	}
+	tables, err := m.sessionTables()
+	if err != nil {
+		return nil, err
+	}
+	var list []OwnerCount
+	index := map[interface{}]int{}
+	for _, table := range tables {
+		query := "SELECT " + m.ownerColumn + ", COUNT(*) AS n FROM " + table +
+			" WHERE " + m.ownerColumn + " IS NOT NULL AND expires >= ?" + m.notDeleted() +
+			" GROUP BY " + m.ownerColumn + " ORDER BY n DESC"
+		if len(tables) == 1 {
+			// With several tables, an owner's counts are added up first.
+			query += " LIMIT " + strconv.Itoa(n)
+		}
+		if list, err = m.countOwners(ctx, query, list, index); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Sessions > list[j].Sessions })
+	return list[:min(len(list), n)], nil
+}
+
+// countOwners adds the owner counts selected by query to list, where index
+// holds the position of each owner.
+func (m *SQLStore) countOwners(ctx context.Context, query string, list []OwnerCount, index map[interface{}]int) ([]OwnerCount, error) {
+	rows, err := m.query(ctx, query, m.dbTime(m.clock.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c OwnerCount
+		if err = rows.Scan(&c.Owner, &c.Sessions); err != nil {
+			return nil, err
+		}
+		if b, ok := c.Owner.([]byte); ok {
+			c.Owner = string(b)
+		}
+		if i, ok := index[c.Owner]; ok {
+			list[i].Sessions += c.Sessions
+			continue
+		}
+		index[c.Owner] = len(list)
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,100 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/admpub/securecookie"
+	sqlstore "github.com/coscms/session-sqlstore"
+)
+
+// ownerDDL is sqlstoretest.DDL with a user_id column for Options.OwnerKey.
+const ownerDDL = "CREATE TABLE IF NOT EXISTS %s (" +
+	"id VARCHAR(100) NOT NULL PRIMARY KEY, " +
+	"data BLOB, " +
+	"created INTEGER NOT NULL DEFAULT 0, " +
+	"modified INTEGER NOT NULL DEFAULT 0, " +
+	"expires INTEGER NOT NULL DEFAULT 0, " +
+	"deleted_at INTEGER, " +
+	"user_id VARCHAR(100))"
+
+var ownerSeq int64
+
+// newOwnerStore creates a store on a fresh in-memory database whose
+// sessions are owned by their user_id value.
+func newOwnerStore(t *testing.T, cfg *sqlstore.Options) *sqlstore.SQLStore {
+	t.Helper()
+	db, err := sql.Open(`sqlite3`, fmt.Sprintf(`file:owners%d?mode=memory&cache=shared`, atomic.AddInt64(&ownerSeq, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Dialect = sqlstore.SQLite
+	cfg.KeyPairs = [][]byte{securecookie.GenerateRandomKey(32)}
+	cfg.PromotedColumns = map[string]string{`user_id`: `user_id`}
+	cfg.OwnerKey = `user_id`
+	cfg.SetDDL(ownerDDL)
+	s, err := sqlstore.New(db, cfg)
+	if err != nil {
+		db.Close()
+		t.Fatalf(`New: %v`, err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		s.Close()
+		db.Close()
+	})
+	return s
+}
+
+// saveOwned saves a new session of owner with c and returns its ID.
+func saveOwned(c *client, owner string) string {
+	r, session := c.get()
+	session.Values[`user_id`] = owner
+	c.save(r, session)
+	return session.ID
+}
+
+func TestTopOwners(t *testing.T) {
+	s := newOwnerStore(t, &sqlstore.Options{})
+	for _, owner := range []string{`alice`, `bob`, `alice`} {
+		saveOwned(newClient(t, s), owner)
+	}
+	top, err := s.TopOwners(context.Background(), 1)
+	if err != nil {
+		t.Fatalf(`TopOwners: %v`, err)
+	}
+	if len(top) != 1 || top[0].Owner != `alice` || top[0].Sessions != 2 {
+		t.Fatalf(`TopOwners(1) = %v, want alice with 2 sessions`, top)
+	}
+	if _, err = s.TopOwners(context.Background(), 0); err == nil {
+		t.Fatal(`TopOwners(0) succeeded, want an error`)
+	}
+}
+
+func TestDestroyAllForOwnerCoversRotatedTables(t *testing.T) {
+	now := time.Date(2024, time.July, 30, 12, 0, 0, 0, time.UTC)
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := newOwnerStore(t, &sqlstore.Options{Rotation: sqlstore.RotateMonthly, Clock: clock})
+	july := newClient(t, s)
+	saveOwned(july, `alice`)
+	now = now.AddDate(0, 0, 3)
+	saveOwned(newClient(t, s), `alice`)
+
+	s.SetReadOnly(true)
+	if _, err := s.DestroyAllForOwner(context.Background(), `alice`); !errors.Is(err, sqlstore.ErrReadOnly) {
+		t.Fatalf(`DestroyAllForOwner in read-only mode: err %v, want ErrReadOnly`, err)
+	}
+	s.SetReadOnly(false)
+	n, err := s.DestroyAllForOwner(context.Background(), `alice`)
+	if err != nil || n != 2 {
+		t.Fatalf(`DestroyAllForOwner = %d, %v, want both periods' sessions`, n, err)
+	}
+	if _, session := july.get(); !session.IsNew {
+		t.Fatal(`the July session survived DestroyAllForOwner`)
+	}
+}
@@ -0,0 +1,82 @@
+package sqlstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/admpub/errors"
+)
+
+var ErrWriteLimited = errors.New("Session write rate limit exceeded")
+
+// tokenBucket limits the rate of database writes. Writes that only extend
+// an expiry may use the upper half of the bucket only, so they are shed
+// first when the database falls behind.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// take takes a token if one is available, keeping half of the bucket for
+// essential writes, and otherwise returns how long until one is.
+func (b *tokenBucket) take(essential bool) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	need := 1.0
+	if !essential {
+		need += b.burst / 2
+	}
+	if b.tokens >= need {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+// allowWrite waits up to Options.WriteWait for a write token. It reports
+// false if the write has to be dropped.
+func (m *SQLStore) allowWrite() bool {
+	if m.limiter == nil {
+		return true
+	}
+	deadline := time.Now().Add(m.writeWait)
+	for {
+		ok, wait := m.limiter.take(true)
+		if ok {
+			return true
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return false
+		}
+		time.Sleep(wait)
+	}
+}
+
+// allowExtension reports whether a write that only extends an expiry may
+// run now.
+func (m *SQLStore) allowExtension() bool {
+	if m.limiter == nil {
+		return true
+	}
+	ok, _ := m.limiter.take(false)
+	return ok
+}
@@ -0,0 +1,21 @@
+package sqlstore
+
+import (
+	"github.com/admpub/errors"
+)
+
+var ErrReadOnly = errors.New("Session store is read-only")
+
+// SetReadOnly switches read-only mode on or off at runtime, e.g. during
+// database maintenance or failover drills. In read-only mode sessions still
+// load, but Save, Delete and Remove fail with ErrReadOnly without touching
+// the database or the cookie, and GC passes are skipped. Callers that want
+// writes to be silently dropped can ignore ErrReadOnly.
+func (m *SQLStore) SetReadOnly(readOnly bool) {
+	m.readOnly.Store(readOnly)
+}
+
+// ReadOnly reports whether the store is in read-only mode.
+func (m *SQLStore) ReadOnly() bool {
+	return m.readOnly.Load()
+}
@@ -0,0 +1,41 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+)
+
+// Reaper is a custom expiration strategy, e.g. dropping partitions,
+// archiving before deleting or ordering by tenant. The cleanup scheduler
+// calls NextBatch and Delete alternately until NextBatch returns no IDs, and
+// then Done.
+type Reaper interface {
+	// NextBatch returns the IDs of the next sessions to remove at now.
+	NextBatch(ctx context.Context, now time.Time) ([]string, error)
+	// Delete removes the sessions of a batch returned by NextBatch.
+	Delete(ctx context.Context, sessionIDs []string) error
+	// Done ends a pass; err is the error that stopped it, if any.
+	Done(ctx context.Context, err error)
+}
+
+// reap runs one pass of the configured Reaper.
+func (m *SQLStore) reap(now time.Time) (err error) {
+	ctx := context.Background()
+	defer func() {
+		m.reaper.Done(ctx, err)
+	}()
+	for {
+		var ids []string
+		ids, err = m.reaper.NextBatch(ctx, now)
+		if err != nil || len(ids) == 0 {
+			return
+		}
+		if err = m.reaper.Delete(ctx, ids); err != nil {
+			return
+		}
+		m.gcDeleted.Add(int64(len(ids)))
+		if m.onExpired != nil {
+			m.onExpired(ids)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"github.com/admpub/sessions"
+	ss "github.com/webx-top/echo/middleware/session/engine"
+)
+
+var _ sessions.Store = (*SQLStore)(nil)
+
+// Reg creates a store on db and registers it with echo's session engine
+// registry under name, e.g. "mysql", so it can be selected by the Engine
+// of the session options.
+func Reg(name string, db *sql.DB, cfg *Options) (*SQLStore, error) {
+	store, err := New(db, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ss.Reg(name, store)
+	return store, nil
+}
+
+// RegWithDSN is like Reg but opens the database handle with driverName and
+// dsn. The store owns the handle.
+func RegWithDSN(name string, driverName string, dsn string, cfg *Options) (*SQLStore, error) {
+	store, err := NewWithDSN(driverName, dsn, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ss.Reg(name, store)
+	return store, nil
+}
@@ -0,0 +1,73 @@
+package sqlstore
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/admpub/sessions"
+	"github.com/webx-top/echo"
+)
+
+// requestContext is the part of a request the store works with. It lets the
+// echo and net/http front ends share a single implementation.
+type requestContext interface {
+	// Cookie returns the value of the named cookie, or "" if it is not set.
+	Cookie(name string) string
+	// SetCookie sets the named cookie using the configured cookie options.
+	SetCookie(name string, value string)
+	// RemoveCookie expires the named cookie.
+	RemoveCookie(name string)
+	// CookieMaxAge returns the max-age of the configured cookie options.
+	CookieMaxAge() int
+	// SetHeader sets a response header.
+	SetHeader(key string, value string)
+	// Context returns the context of the request.
+	Context() context.Context
+	// Request returns the underlying HTTP request, if any.
+	Request() *http.Request
+	// IssuedCookie returns the value the named cookie was set to while
+	// handling the request, or "".
+	IssuedCookie(name string) string
+}
+
+// issuedKey prefixes the context keys recording the cookies set through
+// echoRequest.
+const issuedKey = `sqlstore.issued.`
+
+type echoRequest struct {
+	ctx echo.Context
+}
+
+func (r echoRequest) Cookie(name string) string {
+	return r.ctx.GetCookie(name)
+}
+
+func (r echoRequest) SetCookie(name string, value string) {
+	sessions.SetCookie(r.ctx, name, value)
+	r.ctx.Set(issuedKey+name, value)
+}
+
+func (r echoRequest) RemoveCookie(name string) {
+	sessions.SetCookie(r.ctx, name, ``, -1)
+}
+
+func (r echoRequest) CookieMaxAge() int {
+	return r.ctx.CookieOptions().MaxAge
+}
+
+func (r echoRequest) SetHeader(key string, value string) {
+	r.ctx.Response().Header().Set(key, value)
+}
+
+func (r echoRequest) Context() context.Context {
+	return r.ctx
+}
+
+func (r echoRequest) Request() *http.Request {
+	return r.ctx.Request().StdRequest()
+}
+
+func (r echoRequest) IssuedCookie(name string) string {
+	value, _ := r.ctx.Get(issuedKey + name).(string)
+	return value
+}
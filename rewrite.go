@@ -0,0 +1,130 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// RewriteOptions configures Rewrite.
+type RewriteOptions struct {
+	// Decode decodes the payload of an existing row as read from the data
+	// column. It defaults to the store's own decoding, which reads both the
+	// Serializer and the CanarySerializer format; set it when the format of
+	// the existing rows no longer matches the configuration, e.g. after
+	// switching to Base64 or another Serializer.
+	Decode func(data []byte) (map[interface{}]interface{}, error)
+	// BatchSize is the number of rows read at a time, default
+	// DefaultMigrateBatch.
+	BatchSize int
+	// Progress, if set, is called after each batch with the running result.
+	Progress func(RewriteResult)
+}
+
+// RewriteResult counts the rows handled by Rewrite.
+type RewriteResult struct {
+	Scanned   int64 `json:"scanned"`
+	Rewritten int64 `json:"rewritten"`
+	// Skipped rows were modified while they were rewritten, and are left
+	// as saved, or were already encoded as configured.
+	Skipped int64 `json:"skipped"`
+	// Failed rows could not be decoded; see Scan.
+	Failed int64 `json:"failed"`
+}
+
+// Rewrite re-encodes every row of the session tables with the current
+// Serializer, Base64, Checksum and EncryptedKeys settings, so that enabling
+// them also covers sessions saved before. Rows are updated only if they were
+// not modified in the meantime; expiry and other columns are left as they
+// are.
+func (m *SQLStore) Rewrite(ctx context.Context, opts RewriteOptions) (RewriteResult, error) {
+	var result RewriteResult
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultMigrateBatch
+	}
+	if opts.Decode == nil {
+		opts.Decode = m.decodeRow
+	}
+	tables, err := m.sessionTables()
+	if err != nil {
+		return result, err
+	}
+	for _, table := range tables {
+		if err = m.rewriteTable(ctx, table, opts, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// rewriteTable re-encodes the rows of table for Rewrite, adding to result.
+func (m *SQLStore) rewriteTable(ctx context.Context, table string, opts RewriteOptions, result *RewriteResult) error {
+	query := "SELECT " + strings.Join(m.selCols, ", ") + " FROM " + table + " WHERE id > ? ORDER BY id LIMIT ?"
+	update := "UPDATE " + table + " SET data = ?"
+	if m.checksum {
+		update += ", checksum = ?"
+	}
+	update += " WHERE id = ? AND modified = ?"
+	var last string
+	for {
+		rows, err := m.query(ctx, query, last, opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		var batch []Row
+		for rows.Next() {
+			var row Row
+			if err = m.rowMapper(rows, m.selCols, &row); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, row)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		for i := range batch {
+			row := &batch[i]
+			last = row.ID
+			result.Scanned++
+			values, err := opts.Decode(row.Data)
+			if err != nil {
+				result.Failed++
+				continue
+			}
+			data, err := m.encodeColumn(values)
+			if err != nil {
+				return err
+			}
+			args := []interface{}{data.value}
+			if m.checksum {
+				args = append(args, data.checksum)
+			}
+			args = append(args, row.ID, m.dbStamp(row.Modified))
+			res, err := m.exec(ctx, update, args...)
+			data.release()
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil && n == 0 {
+				result.Skipped++
+			} else {
+				result.Rewritten++
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(*result)
+		}
+		if len(batch) < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+// decodeRow decodes the data column of a row like a load does.
+func (m *SQLStore) decodeRow(data []byte) (map[interface{}]interface{}, error) {
+	values := map[interface{}]interface{}{}
+	err := m.decodeColumn(data, sql.NullInt64{}, &values)
+	return values, err
+}
@@ -0,0 +1,81 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// Table rotation periods for Options.Rotation.
+const (
+	RotateWeekly  = `week`
+	RotateMonthly = `month`
+)
+
+// rotatedTable returns the name of the table of the period back periods
+// before t, e.g. session_2024_07 or session_2024_w27.
+func (m *SQLStore) rotatedTable(t time.Time, back int) string {
+	if m.rotation == RotateWeekly {
+		year, week := t.AddDate(0, 0, -7*back).ISOWeek()
+		return fmt.Sprintf("%s_%d_w%02d", m.current().name, year, week)
+	}
+	t = time.Date(t.Year(), t.Month()-time.Month(back), 1, 0, 0, 0, 0, t.Location())
+	return fmt.Sprintf("%s_%d_%02d", m.current().name, t.Year(), t.Month())
+}
+
+// currentTable resolves the table of the current period.
+func (m *SQLStore) currentTable(ctx context.Context) string {
+	return m.rotatedTable(m.clock.Now(), 0)
+}
+
+// loadPrevious loads session from the table of the previous period and
+// marks it to be inserted into the current table on its next save.
+func (m *SQLStore) loadPrevious(ctx context.Context, session *sessions.Session) error {
+	st, err := m.acquireTable(m.rotatedTable(m.clock.Now(), 1))
+	if err != nil {
+		return err
+	}
+	defer m.release(st)
+	if err = m.load(ctx, st, session); err != nil {
+		return err
+	}
+	session.Values[m.keyPrefix+"rotated"] = true
+	return nil
+}
+
+// popRotated removes the mark set by loadPrevious and reports whether it was
+// set.
+func (m *SQLStore) popRotated(session *sessions.Session) bool {
+	_, ok := session.Values[m.keyPrefix+"rotated"]
+	delete(session.Values, m.keyPrefix+"rotated")
+	return ok
+}
+
+// deletePrevious deletes the row of sessionID from the previous period's
+// table once the session moved forward, so it is not listed or counted
+// twice.
+func (m *SQLStore) deletePrevious(sessionID string) error {
+	st, err := m.acquireTable(m.rotatedTable(m.clock.Now(), 1))
+	if err != nil {
+		return err
+	}
+	defer m.release(st)
+	_, err = m.execWrite(st.delete, sessionID)
+	return err
+}
+
+// dropRotated drops the tables of the periods before the previous one,
+// which reads no longer fall back to.
+func (m *SQLStore) dropRotated(now time.Time) error {
+	// Also catch tables left behind while GC was not running.
+	for back := 2; back <= 4; back++ {
+		table := m.rotatedTable(now, back)
+		m.forget(table)
+		if _, err := m.execRaw(context.Background(), "DROP TABLE IF EXISTS "+m.dialect.Quote(table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestRotationMovesSessionsForward(t *testing.T) {
+	now := time.Date(2024, time.July, 30, 12, 0, 0, 0, time.UTC)
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{Rotation: sqlstore.RotateMonthly, Clock: clock})
+	count := func(table string, id string) (n int) {
+		if err := s.DB.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE id = ?`, id).Scan(&n); err != nil {
+			t.Fatalf(`count %s: %v`, table, err)
+		}
+		return n
+	}
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	id := session.ID
+	if count(`session_2024_07`, id) != 1 {
+		t.Fatal(`the session was not written to the July table`)
+	}
+
+	// In August reads fall back to July and the next save moves the row.
+	now = now.AddDate(0, 0, 3)
+	r, session = c.get()
+	if session.IsNew || session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v (new: %v) in August, want the July session`, session.Values, session.IsNew)
+	}
+	c.save(r, session)
+	if count(`session_2024_08`, id) != 1 || count(`session_2024_07`, id) != 0 {
+		t.Fatal(`saving in August did not move the row to the August table`)
+	}
+	if _, session = c.get(); session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v from the August table, want user alice`, session.Values)
+	}
+
+	if err := s.Remove(id); err != nil {
+		t.Fatalf(`Remove: %v`, err)
+	}
+	if count(`session_2024_07`, id)+count(`session_2024_08`, id) != 0 {
+		t.Fatal(`Remove left the session in a rotated table`)
+	}
+}
+
+func TestRotationHelpersCoverBothPeriods(t *testing.T) {
+	now := time.Date(2024, time.July, 30, 12, 0, 0, 0, time.UTC)
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{Rotation: sqlstore.RotateMonthly, Clock: clock})
+	ctx := context.Background()
+	var ids []string
+	for i := 0; i < 2; i++ {
+		// One session stays in the July table, the other is saved in August.
+		c := newClient(t, s.SQLStore)
+		r, session := c.get()
+		session.Values[`user`] = i
+		c.save(r, session)
+		ids = append(ids, session.ID)
+		now = now.AddDate(0, 0, 3)
+	}
+
+	for _, id := range ids {
+		if ok, err := s.Exists(ctx, id); err != nil || !ok {
+			t.Fatalf(`Exists(%s) = %v, %v, want true`, id, ok, err)
+		}
+	}
+	july := time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)
+	if n, err := s.CreatedBetween(ctx, july, july.AddDate(0, 2, 0)); err != nil || n != 2 {
+		t.Fatalf(`CreatedBetween = %d, %v, want 2`, n, err)
+	}
+	list, err := s.ListByTimeRange(ctx, sqlstore.FieldCreated, july, july.AddDate(0, 2, 0), sqlstore.Page{Offset: 1, Limit: 1})
+	if err != nil || len(list) != 1 || list[0].ID != ids[1] {
+		t.Fatalf(`ListByTimeRange page 2 = %v, %v, want the August session`, list, err)
+	}
+	if stats, err := s.TableStats(ctx); err != nil || stats.Rows != 2 {
+		t.Fatalf(`TableStats = %+v, %v, want 2 rows`, stats, err)
+	}
+	if result, err := s.Scan(ctx, sqlstore.ScanOptions{}); err != nil || result.Scanned != 2 {
+		t.Fatalf(`Scan = %+v, %v, want 2 rows scanned`, result, err)
+	}
+	if n, err := s.InvalidateCreatedBefore(ctx, now); err != nil || n != 2 {
+		t.Fatalf(`InvalidateCreatedBefore = %d, %v, want both sessions`, n, err)
+	}
+}
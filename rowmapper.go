@@ -0,0 +1,81 @@
+package sqlstore
+
+import (
+	"database/sql"
+)
+
+// Row is a session row as read from the table. Created, Modified and Expires
+// are unix seconds, or milliseconds with TimeUnixMilli.
+type Row struct {
+	ID       string
+	Data     []byte
+	Created  int64
+	Modified int64
+	Expires  int64
+	// Checksum is only verified if it is valid.
+	Checksum  sql.NullInt64
+	DeletedAt int64
+	Flags     int64
+	// ElevatedUntil is in the unit of Created.
+	ElevatedUntil int64
+	CSRFSecret    string
+}
+
+// RowScanner is implemented by *sql.Row and *sql.Rows.
+type RowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// RowMapper scans a session row into row. columns lists the selected
+// columns in order: id, data, created, modified and expires, followed by
+// checksum, deleted_at, flags, elevated_until and csrf_secret when enabled.
+// A custom mapper adapts drivers that return unusual column types, such as
+// Oracle NUMBER.
+type RowMapper func(scanner RowScanner, columns []string, row *Row) error
+
+// DefaultRowMapper scans columns with the database/sql conversions, reading
+// NULL as the zero value.
+func DefaultRowMapper(scanner RowScanner, columns []string, row *Row) error {
+	var id, csrf sql.NullString
+	var created, modified, expires, elevated unixTime
+	var deleted, flags sql.NullInt64
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = &id
+		case "data":
+			dest[i] = &row.Data
+		case "created":
+			dest[i] = &created
+		case "modified":
+			dest[i] = &modified
+		case "expires":
+			dest[i] = &expires
+		case "checksum":
+			dest[i] = &row.Checksum
+		case "deleted_at":
+			dest[i] = &deleted
+		case "flags":
+			dest[i] = &flags
+		case "elevated_until":
+			dest[i] = &elevated
+		case "csrf_secret":
+			dest[i] = &csrf
+		default:
+			dest[i] = new(interface{})
+		}
+	}
+	if err := scanner.Scan(dest...); err != nil {
+		return err
+	}
+	row.ID = id.String
+	row.Created = created.ts
+	row.Modified = modified.ts
+	row.Expires = expires.ts
+	row.DeletedAt = deleted.Int64
+	row.Flags = flags.Int64
+	row.ElevatedUntil = elevated.ts
+	row.CSRFSecret = csrf.String
+	return nil
+}
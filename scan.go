@@ -0,0 +1,135 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+
+	"github.com/admpub/errors"
+)
+
+// Actions of ScanOptions.Action.
+const (
+	ScanReport     = ``           // only report corrupt rows
+	ScanDelete     = `delete`     // delete corrupt rows
+	ScanQuarantine = `quarantine` // move corrupt rows to the quarantine table
+)
+
+// ScanOptions configures Scan.
+type ScanOptions struct {
+	// Action is ScanReport (the default), ScanDelete or ScanQuarantine.
+	Action string
+	// QuarantineTable receives the corrupt rows with ScanQuarantine. It
+	// must exist and have the columns of the session table.
+	QuarantineTable string
+	// BatchSize is the number of rows read at a time, default
+	// DefaultMigrateBatch.
+	BatchSize int
+}
+
+// CorruptRow is a row Scan could not decode.
+type CorruptRow struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// ScanResult is the outcome of Scan.
+type ScanResult struct {
+	Scanned int64        `json:"scanned"`
+	Corrupt []CorruptRow `json:"corrupt"`
+	// Removed is the number of corrupt rows deleted or quarantined.
+	Removed int64 `json:"removed"`
+}
+
+// Scan reads every row of the session tables and tries to decode it with the
+// configured serializer, encoding, checksum and encryption key, reporting
+// the rows that fail and optionally deleting or quarantining them. Expired
+// rows are checked as well.
+func (m *SQLStore) Scan(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+	switch opts.Action {
+	case ScanReport, ScanDelete:
+	case ScanQuarantine:
+		if len(opts.QuarantineTable) == 0 {
+			return nil, errors.New("sqlstore: ScanQuarantine requires QuarantineTable")
+		}
+	default:
+		return nil, errors.New("sqlstore: Action must be ScanReport, ScanDelete or ScanQuarantine")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultMigrateBatch
+	}
+	result := &ScanResult{}
+	tables, err := m.sessionTables()
+	if err != nil {
+		return result, err
+	}
+	for _, table := range tables {
+		if err = m.scanTable(ctx, table, opts, result); err != nil {
+			return result, err
+		}
+	}
+	m.checkMassDelete("Scan", result.Removed)
+	return result, nil
+}
+
+// scanTable checks the rows of table for Scan, adding to result.
+func (m *SQLStore) scanTable(ctx context.Context, table string, opts ScanOptions, result *ScanResult) error {
+	query := "SELECT " + strings.Join(m.selCols, ", ") + " FROM " + table + " WHERE id > ? ORDER BY id LIMIT ?"
+	var last string
+	for {
+		rows, err := m.query(ctx, query, last, opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		var n int
+		var corrupt []string
+		for rows.Next() {
+			var row Row
+			if err = m.rowMapper(rows, m.selCols, &row); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+			last = row.ID
+			if err = m.checkRow(&row); err != nil {
+				result.Corrupt = append(result.Corrupt, CorruptRow{ID: row.ID, Error: err.Error()})
+				corrupt = append(corrupt, row.ID)
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		result.Scanned += int64(n)
+		if len(corrupt) > 0 && opts.Action != ScanReport {
+			if opts.Action == ScanQuarantine {
+				err = m.copyRows(ctx, table, m.dialect.Quote(opts.QuarantineTable), corrupt)
+			}
+			if err == nil {
+				err = m.deleteIDs(ctx, table, corrupt)
+			}
+			if err != nil {
+				return err
+			}
+			result.Removed += int64(len(corrupt))
+		}
+		if n < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+// checkRow decodes the payload of row the way a load would.
+func (m *SQLStore) checkRow(row *Row) error {
+	values := map[interface{}]interface{}{}
+	return m.decodeColumn(row.Data, row.Checksum, &values)
+}
+
+// deleteIDs deletes the rows of ids from table.
+func (m *SQLStore) deleteIDs(ctx context.Context, table string, ids []string) error {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	_, err := m.exec(ctx, "DELETE FROM "+table+" WHERE id IN ("+placeholders(len(ids))+")", args...)
+	return err
+}
@@ -0,0 +1,29 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+)
+
+// scrubAndDelete overwrites the payload of sessionID with zeros of the same
+// length and then deletes the row, both in one transaction.
+func (m *SQLStore) scrubAndDelete(st *statements, sessionID string) error {
+	return m.withTx(context.Background(), func(tx *sql.Tx) error {
+		var size sql.NullInt64
+		err := tx.QueryRow(m.dialect.rebind("SELECT LENGTH(data) FROM "+st.table+" WHERE id = ?"), sessionID).Scan(&size)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if size.Int64 > 0 {
+			zeros := make([]byte, size.Int64)
+			if _, err = tx.Exec(m.dialect.rebind("UPDATE "+st.table+" SET data = ? WHERE id = ?"), zeros, sessionID); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(m.dialect.rebind("DELETE FROM "+st.table+" WHERE id = ?"), sessionID)
+		return err
+	})
+}
@@ -0,0 +1,99 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// opLimiter bounds the number of concurrent session queries.
+type opLimiter chan struct{}
+
+func (l opLimiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+func (l opLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// tryAcquire acquires a slot if one is free.
+func (l opLimiter) tryAcquire() bool {
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// hold acquires a slot and returns the function releasing it, which may be
+// called more than once.
+func (l opLimiter) hold() func() {
+	if l == nil {
+		return func() {}
+	}
+	l.acquire()
+	return sync.OnceFunc(l.release)
+}
+
+// limitedStmt is a stmt run within Options.MaxConcurrentOps.
+type limitedStmt struct {
+	stmt
+	ops opLimiter
+}
+
+func (s limitedStmt) Exec(args ...interface{}) (sql.Result, error) {
+	s.ops.acquire()
+	defer s.ops.release()
+	return s.stmt.Exec(args...)
+}
+
+func (s limitedStmt) QueryRow(args ...interface{}) RowScanner {
+	done := s.ops.hold()
+	return limitedRow{row: s.stmt.QueryRow(args...), done: done}
+}
+
+// limitedRow keeps its slot until it is scanned, as the connection is busy
+// until then.
+type limitedRow struct {
+	row  RowScanner
+	done func()
+}
+
+func (r limitedRow) Scan(dest ...interface{}) error {
+	defer r.done()
+	return r.row.Scan(dest...)
+}
+
+// limitedRows keeps its slot until it is closed, as the connection is busy
+// while the result is read. Callers must close it.
+type limitedRows struct {
+	*sql.Rows
+	done func()
+}
+
+func (r *limitedRows) Close() error {
+	defer r.done()
+	return r.Rows.Close()
+}
+
+// withTx runs fn in a transaction, within Options.MaxConcurrentOps for its
+// whole length. The transaction is committed if fn succeeds.
+func (m *SQLStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	m.ops.acquire()
+	defer m.ops.release()
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,39 @@
+package sqlstore_test
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestMaxConcurrentOpsQueuesBeforeThePool(t *testing.T) {
+	sqlstoretest.DriverName = `sqlite3_flaky`
+	defer func() { sqlstoretest.DriverName = `sqlite3` }()
+	flaky.Delay.Store(int64(5 * time.Millisecond))
+	defer flaky.Delay.Store(0)
+	// sqlstoretest opens one connection, so every query over the limit of
+	// one would otherwise wait in the pool.
+	s := sqlstoretest.New(t, &sqlstore.Options{MaxConcurrentOps: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		c := newClient(t, s.SQLStore)
+		r, session := c.get()
+		session.Values[`n`] = i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.h.Save(httptest.NewRecorder(), r, session); err != nil {
+				t.Errorf(`Save: %v`, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if waits := s.DB.Stats().WaitCount; waits > 0 {
+		t.Fatalf(`%d queries waited for a connection, want them held by MaxConcurrentOps`, waits)
+	}
+}
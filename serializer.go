@@ -0,0 +1,83 @@
+package sqlstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONSerializer encodes session values as a JSON object, which databases
+// can inspect and index. Keys are converted to strings; integral numbers
+// decode as int64 and other numbers as float64.
+type JSONSerializer struct{}
+
+// Serialize encodes src, a session values map, as JSON.
+func (JSONSerializer) Serialize(src interface{}) ([]byte, error) {
+	return json.Marshal(jsonObject(src))
+}
+
+// SerializeTo encodes src like Serialize, writing it to w.
+func (JSONSerializer) SerializeTo(w io.Writer, src interface{}) error {
+	return json.NewEncoder(w).Encode(jsonObject(src))
+}
+
+// jsonObject converts a session values map to a map with string keys.
+func jsonObject(src interface{}) interface{} {
+	values, ok := src.(map[interface{}]interface{})
+	if !ok {
+		return src
+	}
+	obj := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		obj[fmt.Sprint(k)] = v
+	}
+	return obj
+}
+
+// Deserialize decodes src into dst, a pointer to a session values map.
+func (s JSONSerializer) Deserialize(src []byte, dst interface{}) error {
+	return s.DeserializeFrom(bytes.NewReader(src), dst)
+}
+
+// DeserializeFrom decodes dst like Deserialize, reading from r.
+func (JSONSerializer) DeserializeFrom(r io.Reader, dst interface{}) error {
+	values, ok := dst.(*map[interface{}]interface{})
+	if !ok {
+		return json.NewDecoder(r).Decode(dst)
+	}
+	var obj map[string]interface{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return err
+	}
+	if *values == nil {
+		*values = make(map[interface{}]interface{}, len(obj))
+	}
+	for k, v := range obj {
+		(*values)[k] = jsonValue(v)
+	}
+	return nil
+}
+
+// jsonValue converts the json.Number values in v to int64 or float64.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = jsonValue(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonValue(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,137 @@
+package sqlstore
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/admpub/sessions"
+	"github.com/webx-top/echo"
+)
+
+var _ sessions.Store = (*ShadowStore)(nil)
+
+// DefaultShadowReads is the number of shadow reads a ShadowStore runs at once
+// when MaxShadowReads is not set.
+var DefaultShadowReads = 8
+
+// MismatchFunc receives the values of a session that differ between the
+// primary and the shadow store. shadow is nil if the shadow store has no
+// such session.
+type MismatchFunc func(name string, id string, primary, shadow map[interface{}]interface{})
+
+// ShadowStore serves sessions from Primary and, for every session it loads,
+// also reads the session with the same ID from Shadow in the background and
+// reports differences, to validate a data migration before cutting traffic
+// over. Writes go to Primary only.
+type ShadowStore struct {
+	Primary    sessions.Store
+	Shadow     *SQLStore
+	OnMismatch MismatchFunc
+	// MaxShadowReads bounds the shadow reads running at once. Sessions
+	// loaded while all of them are busy are not compared, so a slow shadow
+	// database samples the traffic instead of piling up goroutines. The
+	// default is DefaultShadowReads.
+	MaxShadowReads int
+
+	readsOnce  sync.Once
+	reads      opLimiter
+	compared   atomic.Uint64
+	mismatches atomic.Uint64
+	skipped    atomic.Uint64
+}
+
+// NewShadowStore returns a store reading from primary and comparing with
+// shadow.
+func NewShadowStore(primary sessions.Store, shadow *SQLStore, onMismatch MismatchFunc) *ShadowStore {
+	return &ShadowStore{Primary: primary, Shadow: shadow, OnMismatch: onMismatch}
+}
+
+func (s *ShadowStore) Get(ctx echo.Context, name string) (*sessions.Session, error) {
+	s.Shadow.Init()
+	return sessions.GetRegistry(ctx).Get(s, name)
+}
+
+func (s *ShadowStore) New(ctx echo.Context, name string) (*sessions.Session, error) {
+	session, err := s.Primary.New(ctx, name)
+	if err == nil && session != nil && !session.IsNew && len(session.ID) > 0 {
+		s.compare(name, session.ID, session.Values)
+	}
+	return session, err
+}
+
+func (s *ShadowStore) Reload(ctx echo.Context, session *sessions.Session) error {
+	return s.Primary.Reload(ctx, session)
+}
+
+func (s *ShadowStore) Save(ctx echo.Context, session *sessions.Session) error {
+	return s.Primary.Save(ctx, session)
+}
+
+func (s *ShadowStore) Remove(sessionID string) error {
+	return s.Primary.Remove(sessionID)
+}
+
+// Compared returns the number of sessions compared so far.
+func (s *ShadowStore) Compared() uint64 {
+	return s.compared.Load()
+}
+
+// Mismatches returns the number of compared sessions that differed.
+func (s *ShadowStore) Mismatches() uint64 {
+	return s.mismatches.Load()
+}
+
+// Skipped returns the number of loaded sessions not compared because
+// MaxShadowReads reads were running.
+func (s *ShadowStore) Skipped() uint64 {
+	return s.skipped.Load()
+}
+
+// compare loads id from the shadow store in the background and reports a
+// mismatch with the primary values, unless MaxShadowReads reads are running.
+func (s *ShadowStore) compare(name string, id string, values map[interface{}]interface{}) {
+	s.readsOnce.Do(func() {
+		n := s.MaxShadowReads
+		if n <= 0 {
+			n = DefaultShadowReads
+		}
+		s.reads = make(opLimiter, n)
+	})
+	if !s.reads.tryAcquire() {
+		s.skipped.Add(1)
+		return
+	}
+	primary := s.userValues(values)
+	go func() {
+		defer s.reads.release()
+		shadow := sessions.NewSession(s.Shadow, name)
+		shadow.ID = id
+		var shadowValues map[interface{}]interface{}
+		if err := s.Shadow.reload(context.Background(), shadow); err == nil && !shadow.IsNew {
+			shadowValues = s.userValues(shadow.Values)
+		}
+		s.compared.Add(1)
+		if shadowValues != nil && reflect.DeepEqual(primary, shadowValues) {
+			return
+		}
+		s.mismatches.Add(1)
+		if s.OnMismatch != nil {
+			s.OnMismatch(name, id, primary, shadowValues)
+		}
+	}()
+}
+
+// userValues copies values without the meta values of the shadow store.
+func (s *ShadowStore) userValues(values map[interface{}]interface{}) map[interface{}]interface{} {
+	copied := make(map[interface{}]interface{}, len(values))
+	for k, v := range values {
+		if key, ok := k.(string); ok && strings.HasPrefix(key, s.Shadow.keyPrefix) {
+			continue
+		}
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,50 @@
+package sqlstore_test
+
+import (
+	"testing"
+
+	"github.com/admpub/sessions"
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+	"github.com/webx-top/echo"
+)
+
+// storedPrimary is a primary store whose every session was stored before.
+type storedPrimary struct {
+	sessions.Store
+}
+
+func (p storedPrimary) New(ctx echo.Context, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(p, name)
+	session.ID = `stored`
+	session.IsNew = false
+	session.Values[`user`] = `alice`
+	return session, nil
+}
+
+func TestShadowReadsAreBounded(t *testing.T) {
+	shadow := sqlstoretest.New(t, nil)
+	entered, proceed := make(chan struct{}), make(chan struct{})
+	s := sqlstore.NewShadowStore(storedPrimary{}, shadow.SQLStore, func(name, id string, primary, shadow map[interface{}]interface{}) {
+		entered <- struct{}{}
+		<-proceed
+	})
+	s.MaxShadowReads = 1
+
+	// The shadow store lacks the session, so the first read blocks in
+	// OnMismatch and holds the only slot.
+	if _, err := s.New(nil, `SID`); err != nil {
+		t.Fatalf(`New: %v`, err)
+	}
+	<-entered
+	if _, err := s.New(nil, `SID`); err != nil {
+		t.Fatalf(`New: %v`, err)
+	}
+	close(proceed)
+	if n := s.Skipped(); n != 1 {
+		t.Fatalf(`Skipped() = %d while the only shadow read was busy, want 1`, n)
+	}
+	if n := s.Compared(); n != 1 {
+		t.Fatalf(`Compared() = %d, want 1`, n)
+	}
+}
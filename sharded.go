@@ -0,0 +1,157 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/admpub/errors"
+	"github.com/admpub/sessions"
+	"github.com/webx-top/echo"
+)
+
+// shardReplicas is the number of points each database has on the hash ring.
+const shardReplicas = 128
+
+var _ sessions.Store = (*ShardedStore)(nil)
+
+// ShardedStore spreads sessions over several databases by consistent hashing
+// of the session ID. Each database is served by its own SQLStore, which runs
+// its own cleanup.
+type ShardedStore struct {
+	shards []*SQLStore
+	ring   []ringPoint
+}
+
+type ringPoint struct {
+	hash  uint32
+	shard int
+}
+
+// NewSharded creates a store on each of dbs with cfg and routes sessions
+// between them. Options.SharedCookie is not supported.
+func NewSharded(dbs []*sql.DB, cfg *Options) (*ShardedStore, error) {
+	if len(dbs) == 0 {
+		return nil, errors.New("sqlstore: NewSharded requires at least one database")
+	}
+	if len(cfg.SharedCookie) > 0 {
+		return nil, errors.New("sqlstore: SharedCookie is not supported by NewSharded")
+	}
+	s := &ShardedStore{
+		shards: make([]*SQLStore, 0, len(dbs)),
+		ring:   make([]ringPoint, 0, len(dbs)*shardReplicas),
+	}
+	for i := range dbs {
+		for r := 0; r < shardReplicas; r++ {
+			s.ring = append(s.ring, ringPoint{hash: hashKey(strconv.Itoa(i) + "-" + strconv.Itoa(r)), shard: i})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	for i, db := range dbs {
+		store, err := New(db, cfg)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		shard := i
+		// New IDs must route back to the shard that stores them.
+		store.accept = func(id string) bool { return s.locate(id) == shard }
+		s.shards = append(s.shards, store)
+	}
+	return s, nil
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// locate returns the index of the shard of the session id.
+func (s *ShardedStore) locate(id string) int {
+	h := hashKey(id)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].shard
+}
+
+// Shard returns the store holding the session id.
+func (s *ShardedStore) Shard(id string) *SQLStore {
+	return s.shards[s.locate(id)]
+}
+
+// Shards returns the store of each database, in the order given to
+// NewSharded.
+func (s *ShardedStore) Shards() []*SQLStore {
+	return s.shards
+}
+
+// Init starts the cleanup of every shard.
+func (s *ShardedStore) Init() {
+	for _, store := range s.shards {
+		store.Init()
+	}
+}
+
+func (s *ShardedStore) Get(ctx echo.Context, name string) (*sessions.Session, error) {
+	s.Init()
+	return sessions.GetRegistry(ctx).Get(s, name)
+}
+
+// New loads the named session from the shard of the ID in its cookie. New
+// sessions are assigned to a random shard.
+func (s *ShardedStore) New(ctx echo.Context, name string) (*sessions.Session, error) {
+	var id string
+	if value := ctx.GetCookie(name); len(value) > 0 {
+		if err := s.shards[0].decodeCookie(name, value, &id); err != nil {
+			id = ``
+		}
+	}
+	if len(id) == 0 {
+		return s.shards[rand.Intn(len(s.shards))].New(ctx, name)
+	}
+	return s.Shard(id).New(ctx, name)
+}
+
+func (s *ShardedStore) Reload(ctx echo.Context, session *sessions.Session) error {
+	return s.owner(session).Reload(ctx, session)
+}
+
+func (s *ShardedStore) Save(ctx echo.Context, session *sessions.Session) error {
+	return s.owner(session).Save(ctx, session)
+}
+
+func (s *ShardedStore) Delete(ctx echo.Context, session *sessions.Session) error {
+	return s.owner(session).Delete(ctx, session)
+}
+
+func (s *ShardedStore) Remove(sessionID string) error {
+	return s.Shard(sessionID).Remove(sessionID)
+}
+
+// owner returns the shard of session: the one of its ID, or the one that
+// created it while it has no ID.
+func (s *ShardedStore) owner(session *sessions.Session) *SQLStore {
+	if len(session.ID) > 0 {
+		return s.Shard(session.ID)
+	}
+	if store, ok := session.Store().(*SQLStore); ok {
+		return store
+	}
+	return s.shards[0]
+}
+
+// Close closes every shard and returns the first error.
+func (s *ShardedStore) Close() error {
+	var err error
+	for _, store := range s.shards {
+		if closeErr := store.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
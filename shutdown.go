@@ -0,0 +1,52 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/admpub/errors"
+)
+
+var ErrStoreClosed = errors.New("Session store closed")
+
+// begin registers an in-flight database operation. It fails with
+// ErrStoreClosed once Shutdown has been called.
+func (m *SQLStore) begin() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		return ErrStoreClosed
+	}
+	m.inflight.Add(1)
+	return nil
+}
+
+// end marks an operation registered by begin as finished.
+func (m *SQLStore) end() {
+	m.inflight.Done()
+}
+
+// Shutdown stops accepting new saves, waits for in-flight database
+// operations to finish and then closes the store. If ctx is done before the
+// operations have drained, the store is closed anyway and ctx.Err() is
+// returned.
+func (m *SQLStore) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.inflight.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if closeErr := m.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSoftDeleteRetention is how long soft-deleted sessions are kept
+// before GC purges them, unless Options.SoftDeleteRetention is set.
+var DefaultSoftDeleteRetention = 7 * 24 * time.Hour
+
+// Restore undoes the soft deletion of sessionID. It only has an effect when
+// Options.SoftDelete is enabled and the row has not been purged yet.
+func (m *SQLStore) Restore(ctx context.Context, sessionID string) error {
+	_, err := m.execTables(ctx, func(table string) string {
+		return "UPDATE " + table + " SET deleted_at = 0 WHERE id = ? AND deleted_at > 0"
+	}, sessionID)
+	return err
+}
+
+// RestoreDeletedSince undoes every soft deletion made at or after since,
+// which recovers from an accidental mass logout. It returns the number of
+// restored sessions.
+func (m *SQLStore) RestoreDeletedSince(ctx context.Context, since time.Time) (int64, error) {
+	return m.execTables(ctx, func(table string) string {
+		return "UPDATE " + table + " SET deleted_at = 0 WHERE deleted_at > 0 AND deleted_at >= ?"
+	}, since.Unix())
+}
+
+// purgeDeleted removes rows soft-deleted before cutoff.
+func (m *SQLStore) purgeDeleted(cutoff time.Time) error {
+	n, err := m.execTables(context.Background(), func(table string) string {
+		return "DELETE FROM " + table + " WHERE deleted_at > 0 AND deleted_at < ?"
+	}, cutoff.Unix())
+	m.gcDeleted.Add(n)
+	return err
+}
+
+// notDeleted returns a condition, starting with " AND", that excludes
+// soft-deleted rows, or "" if soft deletion is disabled.
+func (m *SQLStore) notDeleted() string {
+	if !m.softDelete {
+		return ``
+	}
+	return " AND (deleted_at IS NULL OR deleted_at = 0)"
+}
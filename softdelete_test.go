@@ -0,0 +1,81 @@
+package sqlstore_test
+
+import (
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestSoftDeletedSessionSavedAgain(t *testing.T) {
+	s := sqlstoretest.New(t, &sqlstore.Options{SoftDelete: true})
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	if err := s.Remove(session.ID); err != nil {
+		t.Fatalf(`Remove: %v`, err)
+	}
+
+	// The old cookie still carries the ID of the soft-deleted row.
+	r, session = c.get()
+	if !session.IsNew || session.Values[`user`] != nil {
+		t.Fatalf(`Get after Remove loaded %v, want a new session`, session.Values)
+	}
+	session.Values[`user`] = `bob`
+	c.save(r, session)
+
+	if _, session = c.get(); session.IsNew || session.Values[`user`] != `bob` {
+		t.Fatalf(`Get after Save = %v (new: %v), want the saved session`, session.Values, session.IsNew)
+	}
+}
+
+func TestRevivedSessionsGetANewCreatedTime(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	now := start
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{SoftDelete: true, MaxAge: 3600, Clock: clock})
+	created := func(id string) (ts int64) {
+		t.Helper()
+		if err := s.DB.QueryRow(`SELECT created FROM session WHERE id = ?`, id).Scan(&ts); err != nil {
+			t.Fatalf(`read created: %v`, err)
+		}
+		return ts
+	}
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+	id := session.ID
+
+	// An update keeps the created time.
+	now = now.Add(time.Minute)
+	r, session = c.get()
+	session.Values[`user`] = `bob`
+	c.save(r, session)
+	if ts := created(id); ts != start.Unix() {
+		t.Fatalf(`created %d after an update, want %d`, ts, start.Unix())
+	}
+
+	for name, end := range map[string]func(){
+		`soft-deleted`: func() {
+			if err := s.Remove(id); err != nil {
+				t.Fatalf(`Remove: %v`, err)
+			}
+		},
+		`expired`: func() { now = now.Add(2 * time.Hour) },
+	} {
+		end()
+		now = now.Add(time.Minute)
+		r, session = c.get()
+		if !session.IsNew || session.ID != id {
+			t.Fatalf(`%s: Get loaded %q (new: %v), want a new session under %q`, name, session.ID, session.IsNew, id)
+		}
+		session.Values[`user`] = `carol`
+		c.save(r, session)
+		if ts := created(id); ts != now.Unix() {
+			t.Fatalf(`%s: created %d after saving again, want %d`, name, ts, now.Unix())
+		}
+	}
+}
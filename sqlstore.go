@@ -1,16 +1,17 @@
 package sqlstore
 
 import (
+	"container/list"
+	"context"
+	"crypto/cipher"
 	"database/sql"
 	"encoding/base32"
-	"fmt"
-	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/admpub/errors"
-	"github.com/admpub/null"
 	"github.com/admpub/securecookie"
 	"github.com/admpub/sessions"
 	"github.com/webx-top/echo"
@@ -25,8 +26,505 @@ type Options struct {
 	EmptyDataAge  int           `json:"emptyDataAge"`
 	MaxLength     int           `json:"maxLength"`
 	CheckInterval time.Duration `json:"checkInterval"`
-	MaxReconnect  int           `json:"maxReconnect"`
-	ddl           string
+	// MaxReconnect is the number of times a write failing during a
+	// failover is retried, see FailoverBackoff. Zero, the default, does not
+	// retry.
+	MaxReconnect int `json:"maxReconnect"`
+
+	// Connection-pool settings applied to the *sql.DB. Zero values leave the
+	// corresponding setting of the handle untouched.
+	MaxOpenConns    int           `json:"maxOpenConns"`
+	MaxIdleConns    int           `json:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `json:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `json:"connMaxIdleTime"`
+
+	// OwnsDB reports whether Close should also close the *sql.DB. It is
+	// false by default because the handle passed to New is usually shared
+	// with the rest of the application; NewWithDSN always owns its handle.
+	OwnsDB bool `json:"ownsDB"`
+
+	// OnError, if set, is called for every error the store swallows or only
+	// logs, such as cookie decode failures, expired loads and GC errors.
+	OnError func(op string, sessionID string, err error) `json:"-"`
+	// TraceID, if set, returns the request or trace ID of a request, which
+	// then tags the log lines of the store about the request and wraps the
+	// errors passed to its hooks in a TraceError. ctx is the echo.Context
+	// with the echo front end and the request context otherwise; see
+	// TraceHeader.
+	TraceID func(ctx context.Context) string `json:"-"`
+
+	// OnDecodeFailure, if set, is called for every session cookie that
+	// cannot be decoded, with one of the Decode* categories, e.g. to alert
+	// on a spike. The failures are also counted in Stats.DecodeFailures.
+	OnDecodeFailure func(category string, err error) `json:"-"`
+
+	// Clock supplies the current time for expiry and cleanup. It defaults to
+	// the system clock and is mainly useful in tests.
+	Clock Clock `json:"-"`
+
+	// Checksum stores a CRC-32 of the serialized data in a `checksum` column
+	// and verifies it on load, which then fails with ErrCorruptSession for a
+	// truncated or damaged row. The column must exist in the DDL. Rows with a
+	// NULL checksum are not verified.
+	Checksum bool `json:"checksum"`
+	// DeleteCorrupt removes rows that fail checksum verification.
+	DeleteCorrupt bool `json:"deleteCorrupt"`
+
+	// SecureDelete overwrites the data column with zeros in the same
+	// transaction before a session is removed, as a best-effort scrub of
+	// sensitive payloads. It applies to Delete and Remove, not to GC.
+	SecureDelete bool `json:"secureDelete"`
+
+	// SoftDelete makes Delete and Remove mark rows in a nullable `deleted_at`
+	// column (unix seconds, NULL or 0 for live rows) instead of removing
+	// them. Marked rows load as missing, can be brought back with Restore
+	// and are purged by GC after SoftDeleteRetention (default 7 days).
+	// Saving a session under the ID of a marked row clears the mark.
+	// SecureDelete has no effect in this mode.
+	SoftDelete          bool          `json:"softDelete"`
+	SoftDeleteRetention time.Duration `json:"softDeleteRetention"`
+
+	// Flags stores the session Flags in an integer `flags` column outside the
+	// payload, so they can be queried in SQL. The column must exist in the
+	// DDL.
+	Flags bool `json:"flags"`
+
+	// ExpiresHeader names a response header, e.g. ExpiresHeaderName, that is
+	// set to the session expiry in unix seconds on every save, so clients can
+	// schedule renewal without an extra request. Empty disables the header.
+	ExpiresHeader string `json:"expiresHeader"`
+
+	// PayloadWarnSize logs a warning listing the value keys of any session
+	// whose serialized payload exceeds this many bytes. Zero disables it.
+	PayloadWarnSize int `json:"payloadWarnSize"`
+	// ObservePayloadSize, if set, receives the serialized size of every
+	// saved payload, e.g. to feed a histogram metric.
+	ObservePayloadSize func(size int) `json:"-"`
+
+	// Base64 stores the serialized data base64-encoded, for a TEXT `data`
+	// column instead of a BLOB.
+	Base64 bool `json:"base64"`
+
+	// Dialect selects the SQL flavor of the database. It defaults to MySQL.
+	// With TiDB, sessions also carry an `expires_at` timestamp for a native
+	// TTL table (see TiDBTTLDDL), which expires rows without GC DELETEs.
+	Dialect Dialect `json:"dialect"`
+	// Serializer encodes session values. It defaults to encoding/gob; see
+	// JSONSerializer for a format the database can inspect.
+	Serializer securecookie.Serializer `json:"-"`
+	// CanarySerializer encodes CanaryPercent percent of the saves, to try a
+	// new format on a slice of traffic. Payloads of either serializer are
+	// read back, so the canary can be widened or rolled back at any time.
+	CanarySerializer securecookie.Serializer `json:"-"`
+	CanaryPercent    int                     `json:"canaryPercent"`
+	// JSONColumn passes the payload as text, for a `data` column of type
+	// JSONB (Postgres) or JSON (MySQL 5.7+), so sessions can be queried and
+	// indexed in SQL. It requires a JSON Serializer.
+	JSONColumn bool `json:"jsonColumn"`
+
+	// PromotedColumns maps session value keys to table columns the values
+	// are copied into on every save, so they can be queried and indexed
+	// while the payload stays opaque. The columns must exist in the DDL.
+	PromotedColumns map[string]string `json:"promotedColumns"`
+	// OwnerKey is the promoted value key that identifies the owner of a
+	// session, e.g. "user_id". It enables DestroyAllForOwner.
+	OwnerKey string `json:"ownerKey"`
+
+	// LastWriterWins only applies an update if the stored row was not
+	// modified later than the saving server's clock, so that after
+	// replication lag in active-active setups an older writer cannot clobber
+	// newer session state. A discarded write is reported to OnError as
+	// ErrStaleWrite.
+	LastWriterWins bool `json:"lastWriterWins"`
+
+	// TokenKey is the session value key, e.g. "api_token", whose value is
+	// copied into an indexed `token` column on every save, so an alternate
+	// identifier handed out by the application resolves to its session with
+	// FindByToken. The column must exist in the DDL.
+	TokenKey string `json:"tokenKey"`
+
+	// StaleGrace keeps returning a session for this long after it expired,
+	// marked stale (see IsStale), while its expiry is renewed in the
+	// background. It smooths over long-poll and streaming requests that
+	// outlive the session; GC spares sessions within the grace period.
+	StaleGrace time.Duration `json:"staleGrace"`
+
+	// ExpiredAccess selects what Get and New do when the cookie references
+	// a session that expired beyond StaleGrace: ExpiredStartFresh (the
+	// default) returns a new session, ExpiredReturnError returns a new
+	// session along with ErrSessionExpired.
+	ExpiredAccess string `json:"expiredAccess"`
+
+	// ClockSkew tolerates sessions that expired up to this long ago on load,
+	// so sessions written by servers with slightly fast clocks are not
+	// rejected by servers with slow ones.
+	ClockSkew time.Duration `json:"clockSkew"`
+
+	// RowMapper scans session rows. It defaults to DefaultRowMapper.
+	RowMapper RowMapper `json:"-"`
+
+	// CookieThreshold keeps sessions whose serialized values fit in this
+	// many bytes encrypted in the cookie itself, without a database row;
+	// larger sessions spill to the table. Keep it well below the cookie
+	// size limit of browsers. Zero stores every session in the database.
+	// Every pair of KeyPairs needs a block key, and a cookie session
+	// expires like a row after the MaxAge of its last save.
+	CookieThreshold int `json:"cookieThreshold"`
+
+	// ExpiredRetention keeps expired rows for this long before GC removes
+	// them, for forensics on recently expired sessions and so that
+	// DestroyAllForOwner also catches sessions that just lapsed. Retained
+	// rows are never served. It does not apply to a custom Reaper.
+	ExpiredRetention time.Duration `json:"expiredRetention"`
+
+	// Rotation writes sessions to a new table every RotateWeekly or
+	// RotateMonthly period, named after Table with a date suffix such as
+	// session_2024_07. Reads fall back to the previous period's table and
+	// move the session forward on its next save; GC drops older tables, so
+	// the hot table stays small. Queries and maintenance methods such as
+	// CountByOwner or Scan cover the current and previous period's tables.
+	// It cannot be combined with TableResolver.
+	Rotation string `json:"rotation"`
+
+	// MaxRows caps the number of rows in each session table. When a GC pass
+	// finds more,
+	// it evicts the least recently modified sessions in batches, protecting
+	// small databases from unbounded growth during bot storms. Zero means
+	// no limit.
+	MaxRows int64 `json:"maxRows"`
+
+	// ReadOnly starts the store in read-only mode, see SetReadOnly.
+	ReadOnly bool `json:"readOnly"`
+
+	// ManualSave turns Save into a no-op, so the implicit save of echo's
+	// session middleware at the end of each request writes nothing and
+	// sessions are only persisted by explicit calls to Flush. The net/http
+	// and gorilla front ends only save when called and are not affected.
+	ManualSave bool `json:"manualSave"`
+
+	// BeforeSave, if set, is called before a session is saved. It may
+	// change the session, e.g. to strip sensitive keys or add bookkeeping
+	// values, or veto the save by returning an error, which Save returns.
+	BeforeSave func(ctx context.Context, session *sessions.Session) error `json:"-"`
+	// AfterSave, if set, is called after a session was saved successfully.
+	AfterSave func(ctx context.Context, session *sessions.Session) `json:"-"`
+
+	// KeyGeneration numbers the first of the KeyPairs, each following pair
+	// being one generation older. When set, cookies are tagged with the
+	// generation of the key that encoded them, so decoding goes straight to
+	// the right codec instead of trying every pair, and cookies of
+	// generations dropped from KeyPairs fail with ErrRetiredKey. Untagged
+	// cookies still try every pair.
+	KeyGeneration int `json:"keyGeneration"`
+
+	// EnrichColumns are metadata columns, e.g. ip, user_agent, country,
+	// asn or device, filled once when a session row is inserted with the
+	// values returned by Enrich, in order, for fraud and anomaly detection.
+	// The columns must exist in the DDL.
+	EnrichColumns []string   `json:"enrichColumns"`
+	Enrich        EnrichFunc `json:"-"`
+
+	// TrackLifetimes adds the lifetimes of the sessions removed by GC to
+	// Stats().Lifetimes, at the cost of reading them before each pass.
+	TrackLifetimes bool `json:"trackLifetimes"`
+
+	// Procedures makes the store call stored procedures instead of inline
+	// SQL. The DDL is not run if it is not set.
+	Procedures *Procedures `json:"procedures"`
+
+	// GCExpiredSQL replaces the statement deleting expired sessions, e.g.
+	// to add index hints, partitions or tenant filters. %s is replaced by
+	// the quoted table and the single ? placeholder receives the time
+	// before which sessions expired, in TimeFormat. With SoftDelete it
+	// should skip soft-deleted rows, which are purged after the retention.
+	GCExpiredSQL string `json:"gcExpiredSQL"`
+	// GCEmptySQL, if set, runs after GCExpiredSQL on each cleanup pass to
+	// delete sessions without data. It is formatted like GCExpiredSQL and
+	// the placeholder receives now minus EmptyDataAge, e.g.
+	// "DELETE FROM %s WHERE modified < ? AND LENGTH(data) < 64".
+	GCEmptySQL string `json:"gcEmptySQL"`
+	// EmptyColumn stores 1 in an integer `is_empty` column for sessions
+	// without values and 0 otherwise, and GC deletes the empty ones not
+	// modified for EmptyDataAge seconds. Unlike a size check in GCEmptySQL,
+	// it does not depend on the serialized format. The column must exist in
+	// the DDL.
+	EmptyColumn bool `json:"emptyColumn"`
+
+	// ElevatedColumn stores the end of step-up authentication granted with
+	// Elevate in an `elevated_until` column, in TimeFormat, so it is
+	// enforced and auditable in SQL; clearing the column revokes it. The
+	// column must exist in the DDL.
+	ElevatedColumn bool `json:"elevatedColumn"`
+
+	// CookieHashColumn stores the CookieHash of the latest cookie issued
+	// for each session in a `cookie_hash` column, so a cookie pasted from a
+	// browser can be matched to its row with FindByCookie, or in SQL,
+	// without the signing keys. The column must exist in the DDL, ideally
+	// indexed.
+	CookieHashColumn bool `json:"cookieHashColumn"`
+
+	// CSRFColumn stores the per-session secret behind CSRFToken and
+	// ValidateCSRF in a `csrf_secret` column, so the tokens need no other
+	// storage and die with the session. The column must exist in the DDL.
+	CSRFColumn bool `json:"csrfColumn"`
+
+	// SharedCookie, if set, is the one cookie carrying the sessions of all
+	// names: it holds a client ID and each named session is stored in the
+	// row with the ID "<client ID>/<name>". Apps using several named
+	// sessions then set a single cookie.
+	SharedCookie string `json:"sharedCookie"`
+
+	// ProxyMode adapts the store to Vitess, ProxySQL and similar proxies:
+	// statements are sent unprepared, so use interpolateParams=true with
+	// the MySQL driver, and the DDL is run one statement at a time. Every
+	// per-session query is keyed by id, so it stays on one shard when id
+	// is the sharding key, see VitessVSchema.
+	ProxyMode bool `json:"proxyMode"`
+
+	// Replica, if set, hedges session loads: when the primary has not
+	// answered within HedgeDelay (default DefaultHedgeDelay), the row is
+	// also read from Replica and the first successful read wins, bounding
+	// load latency during primary hiccups. A session missing on the
+	// replica, e.g. due to replication lag, waits for the primary. A
+	// lagging replica can still return a session that was just changed or
+	// deleted, so loads of a session this instance wrote less than
+	// HedgeQuiet (default DefaultHedgeQuiet) ago are not hedged; writes by
+	// other instances are not covered.
+	Replica    *sql.DB       `json:"-"`
+	HedgeDelay time.Duration `json:"hedgeDelay"`
+	HedgeQuiet time.Duration `json:"hedgeQuiet"`
+
+	// ExpiryWriteBack batches saves that only move the expiry of a session,
+	// the most frequent write of the store: their new expiry is queued and
+	// written every ExpiryWriteBack for many sessions in one UPDATE, and
+	// saves changing nothing are skipped. The queue is flushed by Close and
+	// Shutdown. Zero writes every save at once.
+	ExpiryWriteBack time.Duration `json:"expiryWriteBack"`
+
+	// Galera tunes writes for MariaDB Galera and other multi-master MySQL
+	// clusters: sessions with a newly generated ID use a plain INSERT, GC
+	// deletes in small batches to keep write-sets small, and writes failing
+	// certification (deadlock errors) are retried a few times.
+	Galera bool `json:"galera"`
+
+	// FailoverBackoff is the wait before each retry of a write that failed
+	// because the primary was demoted or went away. Such writes are retried
+	// up to MaxReconnect times. The default is DefaultFailoverBackoff.
+	// Only a store opened by NewWithDSN drops its idle connections before
+	// retrying; the pool of a *sql.DB passed to New is left to database/sql.
+	FailoverBackoff time.Duration `json:"failoverBackoff"`
+	// ErrorNumber returns the server error number and message of a driver
+	// error, for the failover and Galera retries. It defaults to parsing the
+	// "Error 1290 (HY000): message" text of github.com/go-sql-driver/mysql;
+	// set it for other drivers, or to read *mysql.MySQLError with errors.As.
+	ErrorNumber func(err error) (number uint16, message string, ok bool) `json:"-"`
+
+	// TimeFormat is the storage format of the created, modified and
+	// expires columns: TimeUnix (the default), TimeDatetime or
+	// TimeUnixMilli. The DDL must use matching column types.
+	TimeFormat string `json:"timeFormat"`
+	// TimeLocation is the location TimeDatetime values are written in.
+	// The default is UTC.
+	TimeLocation *time.Location `json:"-"`
+
+	// OnMassDelete, if set, is called when a cleanup pass or an admin
+	// operation such as DestroyAllForOwner deletes or invalidates more than
+	// MassDeleteThreshold sessions, so accidental mass logouts are noticed.
+	// The threshold must be positive. MassDeleteWebhook posts them to a URL.
+	OnMassDelete        func(MassDeletion) `json:"-"`
+	MassDeleteThreshold int64              `json:"massDeleteThreshold"`
+
+	// OnCleanup is called after each cleanup pass, e.g. to record it as a
+	// tracing span. The recent passes are also listed by Stats.
+	OnCleanup func(CleanupRun) `json:"-"`
+
+	// WriteRate limits session writes to this many per second, with bursts
+	// of WriteBurst (default WriteRate), to protect a struggling database.
+	// Writes that only extend the expiry of a stale session are shed first;
+	// others wait up to WriteWait and then fail with ErrWriteLimited.
+	WriteRate  float64       `json:"writeRate"`
+	WriteBurst int           `json:"writeBurst"`
+	WriteWait  time.Duration `json:"writeWait"`
+
+	// ClearCookieOnFailure removes the session cookie when a save fails, so
+	// the client does not keep referencing a session whose latest state was
+	// not stored. It has no effect with SharedCookie.
+	ClearCookieOnFailure bool `json:"clearCookieOnFailure"`
+	// ResetInvalidCookie removes a session cookie that cannot be decoded,
+	// e.g. signed with a retired key or tampered with, and returns a new
+	// session instead of the decode error. The error is still passed to
+	// OnError.
+	ResetInvalidCookie bool `json:"resetInvalidCookie"`
+	// StrictMissing makes Get and New fail with ErrSessionNotFound, along
+	// with a new session, when the cookie references a session that does
+	// not exist, so revoked or unknown sessions can be told apart from
+	// requests without a cookie.
+	StrictMissing bool `json:"strictMissing"`
+	// SaveDirtyOnly skips saving sessions not marked with MarkDirty, for
+	// apps that track changes themselves. Deletions are not affected.
+	SaveDirtyOnly bool `json:"saveDirtyOnly"`
+
+	// EncryptedKeys are session value keys whose values are encrypted one
+	// by one with EncryptionKey, an AES key of 16, 24 or 32 bytes, while
+	// the rest of the payload stays readable.
+	EncryptedKeys []string `json:"encryptedKeys"`
+	EncryptionKey []byte   `json:"-"`
+
+	// BlobThreshold moves session values serializing to more than this many
+	// bytes into a side table, keeping the session row small. Values are
+	// moved one by one, so their keys must be strings. BlobTable defaults
+	// to Table + "_blob"; BlobDDL, e.g. MySQLBlobDDL, creates it if set.
+	BlobThreshold int    `json:"blobThreshold"`
+	BlobTable     string `json:"blobTable"`
+	BlobDDL       string `json:"-"`
+
+	// MaxConcurrentOps limits the session queries running at once in this
+	// process, so a slow database does not pile up goroutines holding
+	// connections. Queries over the limit wait, and a query keeps its slot
+	// until its result has been read. Zero means no limit.
+	MaxConcurrentOps int `json:"maxConcurrentOps"`
+
+	// BindClientCert binds sessions to the TLS client certificate of the
+	// request that created them. Loading a session with another
+	// certificate fails with ErrClientCertMismatch, along with a new
+	// session.
+	BindClientCert bool `json:"bindClientCert"`
+
+	// CookieNonce adds a nonce to the session cookie that changes on every
+	// save. A cookie with an outdated nonce is rejected with
+	// ErrReplayedCookie, along with a new session, which limits the use of
+	// a stolen cookie. A replaced nonce stays valid for NonceTolerance
+	// (default DefaultNonceTolerance) after the save that replaced it, so
+	// concurrent requests succeed.
+	CookieNonce    bool          `json:"cookieNonce"`
+	NonceTolerance time.Duration `json:"nonceTolerance"`
+
+	// HeartbeatTable, if set, is a table where every instance records its
+	// InstanceID, last heartbeat and the number of sessions it created
+	// every HeartbeatInterval (default DefaultHeartbeatInterval), see
+	// ClusterStats. HeartbeatDDL, e.g. MySQLHeartbeatDDL, creates it if set.
+	// InstanceID defaults to the host name and process ID.
+	HeartbeatTable    string        `json:"heartbeatTable"`
+	HeartbeatDDL      string        `json:"-"`
+	HeartbeatInterval time.Duration `json:"heartbeatInterval"`
+	InstanceID        string        `json:"instanceID"`
+	// InstanceColumn records the InstanceID of the instance that created
+	// each session in an `instance` column, see ListByInstance. The column
+	// must exist in the DDL.
+	InstanceColumn bool `json:"instanceColumn"`
+	// GCLeaderOnly runs GC only on the live instance with the lowest ID in
+	// HeartbeatTable instead of on every instance.
+	GCLeaderOnly bool `json:"gcLeaderOnly"`
+
+	// OnExpired, if set, receives the IDs of the sessions removed by each GC
+	// pass. Postgres, MariaDB and SQLite collect them with DELETE ...
+	// RETURNING; other dialects select them before deleting.
+	OnExpired func(sessionIDs []string) `json:"-"`
+
+	// Reaper replaces the built-in expiration query with a custom strategy,
+	// run by the same cleanup scheduler.
+	Reaper Reaper `json:"-"`
+
+	// TableResolver picks the session table of a request from its context,
+	// e.g. per tenant or per day; an empty result selects Table. Resolved
+	// tables are created with the DDL on first use and their prepared
+	// statements are kept in an LRU cache of StatementCacheSize tables
+	// (default DefaultStatementCacheSize). Remove works on Table; queries
+	// and maintenance methods such as CountByOwner or Scan cover Table and
+	// the tables in the statement cache, so a table evicted from it is left
+	// out until it is used again.
+	TableResolver      func(ctx context.Context) string `json:"-"`
+	StatementCacheSize int                              `json:"statementCacheSize"`
+
+	ddl string
+}
+
+func (o *Options) validate() error {
+	if len(o.OwnerKey) > 0 {
+		if _, ok := o.PromotedColumns[o.OwnerKey]; !ok {
+			return errors.New("sqlstore: OwnerKey must be one of the PromotedColumns")
+		}
+	}
+	switch o.Rotation {
+	case ``, RotateWeekly, RotateMonthly:
+	default:
+		return errors.New("sqlstore: Rotation must be RotateWeekly or RotateMonthly")
+	}
+	switch o.ExpiredAccess {
+	case ExpiredStartFresh, ExpiredReturnError:
+	default:
+		return errors.New("sqlstore: ExpiredAccess must be ExpiredStartFresh or ExpiredReturnError")
+	}
+	switch o.TimeFormat {
+	case TimeUnix, TimeDatetime, TimeUnixMilli:
+	default:
+		return errors.New("sqlstore: TimeFormat must be TimeUnix, TimeDatetime or TimeUnixMilli")
+	}
+	if o.OnMassDelete != nil && o.MassDeleteThreshold <= 0 {
+		return errors.New("sqlstore: OnMassDelete requires a positive MassDeleteThreshold")
+	}
+	if len(o.Rotation) > 0 && o.TableResolver != nil {
+		return errors.New("sqlstore: Rotation and TableResolver are mutually exclusive")
+	}
+	if o.CookieThreshold > 0 {
+		// Even entries are hash keys, odd ones the block keys encrypting.
+		if len(o.KeyPairs)%2 != 0 {
+			return errors.New("sqlstore: CookieThreshold requires a block key in every key pair")
+		}
+		for i := 1; i < len(o.KeyPairs); i += 2 {
+			if len(o.KeyPairs[i]) == 0 {
+				return errors.New("sqlstore: CookieThreshold requires a block key in every key pair")
+			}
+		}
+	}
+	if o.Procedures != nil {
+		if err := o.Procedures.validate(o); err != nil {
+			return err
+		}
+	}
+	if o.BlobThreshold > 0 && (o.CookieThreshold > 0 || o.Procedures != nil || o.TableResolver != nil || len(o.Rotation) > 0) {
+		return errors.New("sqlstore: BlobThreshold cannot be combined with CookieThreshold, Procedures, TableResolver or Rotation")
+	}
+	if o.CookieNonce && (len(o.SharedCookie) > 0 || o.CookieThreshold > 0) {
+		return errors.New("sqlstore: CookieNonce cannot be combined with SharedCookie or CookieThreshold")
+	}
+	if o.Replica != nil && o.Procedures != nil {
+		return errors.New("sqlstore: Replica and Procedures are mutually exclusive")
+	}
+	if o.ExpiryWriteBack > 0 && (o.Dialect == TiDB || o.Procedures != nil || o.CookieHashColumn || o.CSRFColumn) {
+		return errors.New("sqlstore: ExpiryWriteBack cannot be combined with the TiDB dialect, Procedures, CookieHashColumn or CSRFColumn")
+	}
+	if o.Galera && len(o.Dialect) > 0 && o.Dialect != MySQL && o.Dialect != MariaDB {
+		return errors.New("sqlstore: Galera requires the MySQL or MariaDB dialect")
+	}
+	if o.GCLeaderOnly && len(o.HeartbeatTable) == 0 {
+		return errors.New("sqlstore: GCLeaderOnly requires HeartbeatTable")
+	}
+	if len(o.SharedCookie) > 0 && o.CookieThreshold > 0 {
+		return errors.New("sqlstore: SharedCookie and CookieThreshold are mutually exclusive")
+	}
+	if len(o.TokenKey) > 0 {
+		if _, ok := o.PromotedColumns[o.TokenKey]; ok {
+			return errors.New("sqlstore: TokenKey must not be one of the PromotedColumns")
+		}
+	}
+	if o.JSONColumn {
+		if _, ok := o.Serializer.(JSONSerializer); !ok {
+			return errors.New("sqlstore: JSONColumn requires the JSONSerializer")
+		}
+		if o.CanarySerializer != nil {
+			return errors.New("sqlstore: JSONColumn and CanarySerializer are mutually exclusive")
+		}
+		if o.Base64 {
+			return errors.New("sqlstore: JSONColumn and Base64 are mutually exclusive")
+		}
+		// JSON columns normalize the document, so the stored bytes differ
+		// from the ones that were checksummed.
+		if o.Checksum {
+			return errors.New("sqlstore: JSONColumn and Checksum are mutually exclusive")
+		}
+	}
+	return nil
 }
 
 func (o *Options) SetDDL(ddl string) *Options {
@@ -34,31 +532,164 @@ func (o *Options) SetDDL(ddl string) *Options {
 	return o
 }
 
+func (o *Options) applyPool(db *sql.DB) {
+	if o.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+	if o.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(o.ConnMaxIdleTime)
+	}
+}
+
 type SQLStore struct {
-	db          *sql.DB
-	stmtInsert  *sql.Stmt
-	stmtDelete  *sql.Stmt
-	stmtUpdate  *sql.Stmt
-	stmtSelect  *sql.Stmt
-	gcMaxAgeSQL string
+	db        *sql.DB
+	ownsDB    bool
+	idleConns int         // the idle pool size of a handle opened by NewWithDSN
+	stmts     *statements // guarded by stmtCache.mu
+	stmtCache stmtCache
+	ddl       string
+	insCols   []string
+	updCols   []string
+	selCols   []string
 
 	Codecs        []securecookie.Codec
-	table         string
 	maxAge        int
 	emptyDataAge  int
 	checkInterval time.Duration
 	keyPrefix     string
+	onError       func(op string, sessionID string, err error)
+	onDecodeFail  func(category string, err error)
+	traceID       func(ctx context.Context) string
+	clock         Clock
+	checksum      bool
+	deleteCorrupt bool
+	secureDelete  bool
+	softDelete    bool
+	retention     time.Duration
+	flags         bool
+	expiresHeader string
+	payloadWarn   int
+	observeSize   func(size int)
+	stats         stats
+	base64        bool
+	dialect       Dialect
+	serializer    securecookie.Serializer
+	canary        securecookie.Serializer
+	canaryPct     int
+	jsonColumn    bool
+	promoted      []promotedColumn
+	ownerColumn   string
+	lastWriteWins bool
+	onExpired     func(sessionIDs []string)
+	reaper        Reaper
+	tokenKey      string
+	staleGrace    time.Duration
+	clockSkew     time.Duration
+	rowMapper     RowMapper
+	cookieLimit   int
+	keepExpired   time.Duration
+	rotation      string
+	maxRows       int64
+	readOnly      atomic.Bool
+	rotateBefore  atomic.Int64
+	manualSave    bool
+	beforeSave    func(ctx context.Context, session *sessions.Session) error
+	afterSave     func(ctx context.Context, session *sessions.Session)
+	keyGen        int
+	enrichCols    []string
+	enrich        EnrichFunc
+	trackLife     bool
+	procs         *Procedures
+	gcExpired     string
+	gcEmpty       string
+	emptyCol      bool
+	elevatedCol   bool
+	cookieHash    bool
+	csrfCol       bool
+	sharedCookie  string
+	accept        func(id string) bool
+	proxyMode     bool
+	maxReconnect  int
+	failoverWait  time.Duration
+	errorNumber   func(err error) (uint16, string, bool)
+	galera        bool
+	writeBack     time.Duration
+	expiryQ       expiryQueue
+	replica       *sql.DB
+	hedgeDelay    time.Duration
+	hedgeQuiet    time.Duration
+	written       recentWrites
+	timeFormat    string
+	timeLoc       *time.Location
+	onCleanup     func(CleanupRun)
+	onMassDelete  func(MassDeletion)
+	massDelete    int64
+	cleanups      cleanupLog
+	gcDeleted     atomic.Int64
+	limiter       *tokenBucket
+	writeWait     time.Duration
+	clearOnFail   bool
+	resetInvalid  bool
+	strictMiss    bool
+	expiredErr    bool
+	dirtyOnly     bool
+	encKeys       map[string]struct{}
+	valueAEAD     cipher.AEAD
+	blobLimit     int
+	blobTable     string
+	ops           opLimiter
+	bindCert      bool
+	cookieNonce   bool
+	nonceWindow   time.Duration
+	instanceID    string
+	instanceCol   bool
+	hbTable       string
+	hbInterval    time.Duration
+	hbQuit        chan struct{}
+	hbDone        chan struct{}
+	gcLeader      bool
+	newSessions   atomic.Int64
+	mirror        atomic.Pointer[string]
+	tableSnap     tableSnapshot
+	options       Options
+	errLog        errorLog
+	closed        atomic.Bool
+	resolveTable  func(ctx context.Context) string
 	quiteC        chan<- struct{}
 	doneC         <-chan struct{}
+	mu            sync.Mutex
+	closing       bool
+	inflight      sync.WaitGroup
 	once          sync.Once
+	closeOnce     sync.Once
+	closeErr      error
 }
 
-type sessionRow struct {
-	id       null.String
-	data     null.Bytes
-	created  null.Int64
-	modified null.Int64
-	expires  null.Int64
+// NewWithDSN opens a database handle with driverName and dsn and creates a
+// store on it.
+func NewWithDSN(driverName string, dsn string, cfg *Options) (*SQLStore, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.ownsDB = true
+	s.idleConns = cfg.MaxIdleConns
+	if s.idleConns <= 0 {
+		// The default of a new database/sql pool.
+		s.idleConns = 2
+	}
+	return s, nil
 }
 
 // New .
@@ -66,74 +697,282 @@ func New(db *sql.DB, cfg *Options) (*SQLStore, error) {
 	if len(cfg.Table) == 0 {
 		cfg.Table = `session`
 	}
-	// Make sure table name is enclosed.
-	tableName := "`" + strings.Trim(cfg.Table, "`") + "`"
-
-	cTableQ := fmt.Sprintf(cfg.ddl, tableName)
-	if _, err := db.Exec(cTableQ); err != nil {
-		return nil, errors.Wrap(err, cTableQ)
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
-
-	insQ := "REPLACE INTO " + tableName +
-		"(id, data, created, modified, expires) VALUES (?, ?, ?, ?, ?)"
-	stmtInsert, stmtErr := db.Prepare(insQ)
-	if stmtErr != nil {
-		return nil, errors.Wrap(stmtErr, insQ)
+	cfg.applyPool(db)
+	dialect := cfg.Dialect
+	if len(dialect) == 0 {
+		dialect = MySQL
 	}
-
-	delQ := "DELETE FROM " + tableName + " WHERE id = ?"
-	stmtDelete, stmtErr := db.Prepare(delQ)
-	if stmtErr != nil {
-		return nil, errors.Wrap(stmtErr, delQ)
+	insCols := []string{"id", "data", "created", "modified", "expires"}
+	updCols := []string{"data", "created", "modified", "expires"}
+	selCols := []string{"id", "data", "created", "modified", "expires"}
+	if dialect == TiDB {
+		insCols = append(insCols, "expires_at")
+		updCols = append(updCols, "expires_at")
 	}
-
-	updQ := "UPDATE " + tableName + " SET data = ?, created = ?, expires = ? " +
-		"WHERE id = ?"
-	stmtUpdate, stmtErr := db.Prepare(updQ)
-	if stmtErr != nil {
-		return nil, errors.Wrap(stmtErr, updQ)
+	if cfg.Checksum {
+		insCols = append(insCols, "checksum")
+		updCols = append(updCols, "checksum")
+		selCols = append(selCols, "checksum")
 	}
-
-	selQ := "SELECT id, data, created, modified, expires from " +
-		tableName + " WHERE id = ?"
-	stmtSelect, stmtErr := db.Prepare(selQ)
-	if stmtErr != nil {
-		return nil, errors.Wrap(stmtErr, selQ)
+	if cfg.SoftDelete {
+		selCols = append(selCols, "deleted_at")
+	}
+	if cfg.Flags {
+		insCols = append(insCols, "flags")
+		updCols = append(updCols, "flags")
+		selCols = append(selCols, "flags")
+	}
+	if cfg.EmptyColumn {
+		insCols = append(insCols, "is_empty")
+		updCols = append(updCols, "is_empty")
+	}
+	if cfg.ElevatedColumn {
+		insCols = append(insCols, "elevated_until")
+		updCols = append(updCols, "elevated_until")
+		selCols = append(selCols, "elevated_until")
+	}
+	if cfg.CookieHashColumn {
+		insCols = append(insCols, "cookie_hash")
+		updCols = append(updCols, "cookie_hash")
+	}
+	if cfg.CSRFColumn {
+		insCols = append(insCols, "csrf_secret")
+		updCols = append(updCols, "csrf_secret")
+		selCols = append(selCols, "csrf_secret")
 	}
+	promoted := cfg.promoted()
+	for _, p := range promoted {
+		insCols = append(insCols, p.column)
+		updCols = append(updCols, p.column)
+	}
+	var enrichCols []string
+	if cfg.Enrich != nil {
+		enrichCols = cfg.EnrichColumns
+		insCols = append(insCols, enrichCols...)
+	}
+	if cfg.InstanceColumn {
+		insCols = append(insCols, "instance")
+	}
+
 	s := &SQLStore{
 		db:            db,
-		stmtInsert:    stmtInsert,
-		stmtDelete:    stmtDelete,
-		stmtUpdate:    stmtUpdate,
-		stmtSelect:    stmtSelect,
-		gcMaxAgeSQL:   "DELETE FROM " + tableName + " WHERE expires < ",
+		ownsDB:        cfg.OwnsDB,
 		Codecs:        securecookie.CodecsFromPairs(cfg.KeyPairs...),
-		table:         tableName,
 		maxAge:        cfg.MaxAge,
 		emptyDataAge:  cfg.EmptyDataAge,
 		keyPrefix:     cfg.KeyPrefix,
 		checkInterval: cfg.CheckInterval,
+		onError:       cfg.OnError,
+		onDecodeFail:  cfg.OnDecodeFailure,
+		traceID:       cfg.TraceID,
+		clock:         cfg.Clock,
+		checksum:      cfg.Checksum,
+		deleteCorrupt: cfg.DeleteCorrupt,
+		secureDelete:  cfg.SecureDelete,
+		softDelete:    cfg.SoftDelete,
+		retention:     cfg.SoftDeleteRetention,
+		flags:         cfg.Flags,
+		expiresHeader: cfg.ExpiresHeader,
+		payloadWarn:   cfg.PayloadWarnSize,
+		observeSize:   cfg.ObservePayloadSize,
+		base64:        cfg.Base64,
+		dialect:       dialect,
+		serializer:    cfg.Serializer,
+		canary:        cfg.CanarySerializer,
+		canaryPct:     cfg.CanaryPercent,
+		jsonColumn:    cfg.JSONColumn,
+		promoted:      promoted,
+		lastWriteWins: cfg.LastWriterWins,
+		onExpired:     cfg.OnExpired,
+		reaper:        cfg.Reaper,
+		tokenKey:      cfg.TokenKey,
+		staleGrace:    cfg.StaleGrace,
+		clockSkew:     cfg.ClockSkew,
+		rowMapper:     cfg.RowMapper,
+		cookieLimit:   cfg.CookieThreshold,
+		keepExpired:   cfg.ExpiredRetention,
+		rotation:      cfg.Rotation,
+		maxRows:       cfg.MaxRows,
+		manualSave:    cfg.ManualSave,
+		beforeSave:    cfg.BeforeSave,
+		afterSave:     cfg.AfterSave,
+		keyGen:        cfg.KeyGeneration,
+		enrichCols:    enrichCols,
+		enrich:        cfg.Enrich,
+		trackLife:     cfg.TrackLifetimes,
+		procs:         cfg.Procedures,
+		gcExpired:     cfg.GCExpiredSQL,
+		gcEmpty:       cfg.GCEmptySQL,
+		emptyCol:      cfg.EmptyColumn,
+		elevatedCol:   cfg.ElevatedColumn,
+		cookieHash:    cfg.CookieHashColumn,
+		csrfCol:       cfg.CSRFColumn,
+		sharedCookie:  cfg.SharedCookie,
+		proxyMode:     cfg.ProxyMode,
+		maxReconnect:  cfg.MaxReconnect,
+		errorNumber:   cfg.ErrorNumber,
+		failoverWait:  cfg.FailoverBackoff,
+		galera:        cfg.Galera,
+		writeBack:     cfg.ExpiryWriteBack,
+		replica:       cfg.Replica,
+		hedgeDelay:    cfg.HedgeDelay,
+		hedgeQuiet:    cfg.HedgeQuiet,
+		timeFormat:    cfg.TimeFormat,
+		timeLoc:       cfg.TimeLocation,
+		onCleanup:     cfg.OnCleanup,
+		onMassDelete:  cfg.OnMassDelete,
+		massDelete:    cfg.MassDeleteThreshold,
+		writeWait:     cfg.WriteWait,
+		clearOnFail:   cfg.ClearCookieOnFailure,
+		resetInvalid:  cfg.ResetInvalidCookie,
+		strictMiss:    cfg.StrictMissing,
+		expiredErr:    cfg.ExpiredAccess == ExpiredReturnError,
+		dirtyOnly:     cfg.SaveDirtyOnly,
+		blobLimit:     cfg.BlobThreshold,
+		bindCert:      cfg.BindClientCert,
+		cookieNonce:   cfg.CookieNonce,
+		nonceWindow:   cfg.NonceTolerance,
+		instanceID:    cfg.InstanceID,
+		instanceCol:   cfg.InstanceColumn,
+		hbInterval:    cfg.HeartbeatInterval,
+		gcLeader:      cfg.GCLeaderOnly,
+		options:       *cfg,
+		resolveTable:  cfg.TableResolver,
+		ddl:           cfg.ddl,
+		insCols:       insCols,
+		updCols:       updCols,
+		selCols:       selCols,
+	}
+	if cfg.MaxConcurrentOps > 0 {
+		s.ops = make(opLimiter, cfg.MaxConcurrentOps)
+	}
+	var err error
+	if s.stmts, err = s.prepare(cfg.Table); err != nil {
+		return nil, err
+	}
+	if len(s.rotation) > 0 {
+		s.resolveTable = s.currentTable
+	}
+	if s.resolveTable != nil {
+		s.stmtCache = stmtCache{
+			size:    cfg.StatementCacheSize,
+			lru:     list.New(),
+			entries: map[string]*statements{},
+		}
+		if s.stmtCache.size <= 0 {
+			s.stmtCache.size = DefaultStatementCacheSize
+		}
 	}
 	if cfg.MaxLength > 0 {
 		s.MaxLength(cfg.MaxLength)
 	}
+	s.readOnly.Store(cfg.ReadOnly)
 	if len(s.keyPrefix) == 0 {
 		s.keyPrefix = `_`
 	}
 	if s.emptyDataAge <= 0 {
 		s.emptyDataAge = ss.EmptyDataAge
 	}
+	if s.clock == nil {
+		s.clock = SystemClock
+	}
+	if s.rowMapper == nil {
+		s.rowMapper = DefaultRowMapper
+	}
+	if err := s.checkSessionTypes(); err != nil {
+		s.closeStatements()
+		return nil, err
+	}
+	if len(cfg.OwnerKey) > 0 {
+		s.ownerColumn = cfg.PromotedColumns[cfg.OwnerKey]
+	}
+	if len(cfg.EncryptedKeys) > 0 {
+		if s.valueAEAD, err = newValueCipher(cfg.EncryptionKey); err != nil {
+			s.closeStatements()
+			return nil, err
+		}
+		s.encKeys = make(map[string]struct{}, len(cfg.EncryptedKeys))
+		for _, key := range cfg.EncryptedKeys {
+			s.encKeys[key] = struct{}{}
+		}
+	}
+	if s.blobLimit > 0 {
+		blobTable := cfg.BlobTable
+		if len(blobTable) == 0 {
+			blobTable = cfg.Table + `_blob`
+		}
+		s.blobTable = s.dialect.Quote(blobTable)
+		if len(cfg.BlobDDL) > 0 {
+			if err = s.createBlobTable(cfg.BlobDDL); err != nil {
+				s.closeStatements()
+				return nil, err
+			}
+		}
+	}
+	if len(s.instanceID) == 0 {
+		s.instanceID = defaultInstanceID()
+	}
+	if len(cfg.HeartbeatTable) > 0 {
+		s.hbTable = s.dialect.Quote(cfg.HeartbeatTable)
+		if s.hbInterval <= 0 {
+			s.hbInterval = DefaultHeartbeatInterval
+		}
+		if len(cfg.HeartbeatDDL) > 0 {
+			if err = s.createHeartbeatTable(cfg.HeartbeatDDL); err != nil {
+				s.closeStatements()
+				return nil, err
+			}
+		}
+	}
+	if cfg.WriteRate > 0 {
+		s.limiter = newTokenBucket(cfg.WriteRate, cfg.WriteBurst)
+	}
+	if s.timeLoc == nil {
+		s.timeLoc = time.UTC
+	}
+	if s.hedgeDelay <= 0 {
+		s.hedgeDelay = DefaultHedgeDelay
+	}
+	if s.hedgeQuiet <= 0 {
+		s.hedgeQuiet = DefaultHedgeQuiet
+	}
+	if s.nonceWindow <= 0 {
+		s.nonceWindow = DefaultNonceTolerance
+	}
+	if s.failoverWait <= 0 {
+		s.failoverWait = DefaultFailoverBackoff
+	}
+	if s.errorNumber == nil {
+		s.errorNumber = mysqlError
+	}
+	if s.softDelete {
+		if s.retention <= 0 {
+			s.retention = DefaultSoftDeleteRetention
+		}
+	}
 	return s, nil
 }
 
-func (m *SQLStore) Close() (err error) {
-	m.stmtSelect.Close()
-	m.stmtUpdate.Close()
-	m.stmtDelete.Close()
-	m.stmtInsert.Close()
-	err = m.db.Close()
-	m.closeCleanup()
-	return
+// Close stops the background cleanup, waiting for a running pass to finish,
+// and releases the prepared statements. It is safe to call Close more than
+// once and from multiple goroutines.
+func (m *SQLStore) Close() error {
+	m.closeOnce.Do(func() {
+		// Keep Init from starting a cleanup on a closed store.
+		m.once.Do(func() {})
+		m.closeCleanup()
+		m.stopHeartbeat()
+		m.stopWriteBack()
+		m.closed.Store(true)
+		m.closeStatements()
+		if m.ownsDB {
+			m.closeErr = m.db.Close()
+		}
+	})
+	return m.closeErr
 }
 
 func (m *SQLStore) Get(ctx echo.Context, name string) (*sessions.Session, error) {
@@ -142,74 +981,282 @@ func (m *SQLStore) Get(ctx echo.Context, name string) (*sessions.Session, error)
 }
 
 func (m *SQLStore) New(ctx echo.Context, name string) (*sessions.Session, error) {
+	return m.newSession(echoRequest{ctx}, name)
+}
+
+func (m *SQLStore) newSession(r requestContext, name string) (*sessions.Session, error) {
 	session := sessions.NewSession(m, name)
 	session.IsNew = true
 	var err error
-	value := ctx.GetCookie(name)
+	value := r.Cookie(m.cookieName(name))
 	if len(value) == 0 {
 		return session, err
 	}
-	err = securecookie.DecodeMulti(name, value, &session.ID, m.Codecs...)
+	err = m.decodeCookie(m.cookieName(name), value, &session.ID)
 	if err != nil {
+		m.observeDecodeFailure(r.Context(), err)
+		if m.resetInvalid {
+			session.ID = ``
+			r.RemoveCookie(m.cookieName(name))
+			return session, nil
+		}
 		return session, err
 	}
-	err = m.load(session)
-	if err == nil {
-		session.IsNew = false
-	} else if err == sql.ErrNoRows || err == ErrSessionExpired {
-		err = nil
+	var nonce string
+	if m.cookieNonce {
+		session.ID, nonce = splitNonce(session.ID)
+	}
+	session.ID = m.rowID(session.ID, name)
+	if inCookie, err := m.loadFromCookie(r.Context(), session, session.ID); inCookie {
+		session.ID = ``
+		if err != nil && err != ErrSessionExpired {
+			m.observeDecodeFailure(r.Context(), err)
+		}
+		return session, err
+	}
+	err = m.reload(r.Context(), session)
+	if err == nil && m.cookieNonce && !session.IsNew {
+		if err = m.checkNonce(session, nonce); err != nil {
+			m.reportErrorCtx(r.Context(), OpLoad, session.ID, err)
+			session = sessions.NewSession(m, name)
+			session.IsNew = true
+			return session, err
+		}
+	}
+	if err == nil && m.bindCert && !session.IsNew {
+		if err = m.checkClientCert(r, session); err != nil {
+			m.reportErrorCtx(r.Context(), OpLoad, session.ID, err)
+			// Hand out a fresh session rather than the one of the other
+			// certificate.
+			session = sessions.NewSession(m, name)
+			session.IsNew = true
+		}
 	}
 	return session, err
 }
 
 func (m *SQLStore) Reload(ctx echo.Context, session *sessions.Session) error {
-	err := m.load(session)
+	return m.reload(ctx, session)
+}
+
+func (m *SQLStore) reload(ctx context.Context, session *sessions.Session) error {
+	st, err := m.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.release(st)
+	err = m.load(ctx, st, session)
+	if err == sql.ErrNoRows && len(m.rotation) > 0 {
+		err = m.loadPrevious(ctx, session)
+	}
 	if err == nil {
 		session.IsNew = false
-	} else if err == sql.ErrNoRows || err == ErrSessionExpired {
+		m.markIDRotation(session)
+		return nil
+	}
+	m.reportErrorCtx(ctx, OpLoad, session.ID, err)
+	if err == sql.ErrNoRows && m.strictMiss {
+		return ErrSessionNotFound
+	}
+	if err == ErrSessionExpired && m.expiredErr {
+		return err
+	}
+	if err == sql.ErrNoRows || err == ErrSessionExpired {
 		err = nil
 	}
 	return err
 }
 
 func (m *SQLStore) Save(ctx echo.Context, session *sessions.Session) error {
-	var err error
+	if m.manualSave {
+		return nil
+	}
+	return m.saveSession(echoRequest{ctx}, session)
+}
+
+// Flush persists session and writes its cookie. It is the only way to save
+// a session when Options.ManualSave is set.
+func (m *SQLStore) Flush(ctx echo.Context, session *sessions.Session) error {
+	return m.saveSession(echoRequest{ctx}, session)
+}
+
+func (m *SQLStore) saveSession(r requestContext, session *sessions.Session) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+	if m.readOnly.Load() {
+		return ErrReadOnly
+	}
 	// Delete if max-age is < 0
-	if ctx.CookieOptions().MaxAge < 0 {
-		return m.Delete(ctx, session)
+	if r.CookieMaxAge() < 0 {
+		return m.deleteSession(r, session)
 	}
-	if len(session.ID) == 0 {
-		// generate random session ID key suitable for storage in the db
-		session.ID = strings.TrimRight(
-			base32.StdEncoding.EncodeToString(
-				securecookie.GenerateRandomKey(32)), "=")
-		if err = m.insert(ctx, session); err != nil {
+	if m.beforeSave != nil {
+		if err := m.beforeSave(r.Context(), session); err != nil {
 			return err
 		}
-	} else if err = m.save(ctx, session); err != nil {
+	}
+	if !m.popDirty(session) && m.dirtyOnly {
+		return nil
+	}
+	m.purgeExpiredValues(session)
+	if err := m.persist(r, session); err != nil {
+		if m.clearOnFail && len(m.sharedCookie) == 0 {
+			r.RemoveCookie(session.Name())
+		}
 		return err
 	}
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, m.Codecs...)
+	if m.afterSave != nil {
+		m.afterSave(r.Context(), session)
+	}
+	return nil
+}
+
+// persist writes session to the cookie or the database and sets its cookie.
+// The cookie is only set once the database write succeeded.
+func (m *SQLStore) persist(r requestContext, session *sessions.Session) error {
+	if m.cookieLimit > 0 {
+		if inCookie, err := m.saveToCookie(r, session); inCookie || err != nil {
+			return err
+		}
+	}
+	st, err := m.acquire(r.Context())
 	if err != nil {
 		return err
 	}
-	sessions.SetCookie(ctx, session.Name(), encoded)
+	defer m.release(st)
+	if m.bindCert {
+		m.bindClientCert(r, session)
+	}
+	var nonce string
+	if m.cookieNonce {
+		nonce = m.rotateNonce(session)
+	}
+	isNew := len(session.ID) == 0
+	var generated bool
+	if isNew {
+		if len(m.sharedCookie) > 0 {
+			session.ID = m.issuedClient(r)
+		}
+		if len(session.ID) == 0 {
+			session.ID = m.generateID()
+			generated = true
+		}
+		session.ID = m.rowID(session.ID, session.Name())
+		if err = m.removeReplaced(r.Context(), session); err != nil {
+			return err
+		}
+		m.issueID(session)
+	}
+	// The cookie is encoded ahead of the write so its hash can be stored
+	// with the row.
+	name := m.cookieName(session.Name())
+	value := m.clientID(session.ID)
+	if m.cookieNonce {
+		value += nonceSep + nonce
+	}
+	encoded, err := m.encodeCookie(name, value)
+	if err != nil {
+		return err
+	}
+	if m.cookieHash {
+		session.Values[m.keyPrefix+"cookieHash"] = CookieHash(encoded)
+	}
+	m.noteWrite(session.ID)
+	if isNew {
+		if err = m.insert(st, r, session, generated); err != nil {
+			return err
+		}
+		m.newSessions.Add(1)
+	} else if err = m.save(st, r, session); err != nil {
+		return err
+	}
+	if err = m.mirrorRow(r.Context(), st, session.ID); err != nil {
+		return err
+	}
+	r.SetCookie(name, encoded)
 	return nil
 }
 
+// generateID returns a random session ID suitable for storage in the db.
+func (m *SQLStore) generateID() string {
+	for {
+		id := strings.TrimRight(
+			base32.StdEncoding.EncodeToString(
+				securecookie.GenerateRandomKey(32)), "=")
+		if m.accept == nil || m.accept(id) {
+			return id
+		}
+	}
+}
+
 func (m *SQLStore) Remove(sessionID string) error {
+	if len(m.rotation) > 0 {
+		return m.removeResolved(context.Background(), sessionID)
+	}
+	st := m.acquireDefault()
+	defer m.release(st)
+	return m.remove(st, sessionID)
+}
+
+// removeResolved removes sessionID from the table resolved for ctx and, when
+// tables rotate, from the previous period's table that reads fall back to.
+func (m *SQLStore) removeResolved(ctx context.Context, sessionID string) error {
+	st, err := m.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = m.remove(st, sessionID)
+	m.release(st)
+	if err != nil || len(m.rotation) == 0 {
+		return err
+	}
+	if st, err = m.acquireTable(m.rotatedTable(m.clock.Now(), 1)); err != nil {
+		return err
+	}
+	defer m.release(st)
+	return m.remove(st, sessionID)
+}
+
+func (m *SQLStore) remove(st *statements, sessionID string) error {
 	if len(sessionID) == 0 {
 		return nil
 	}
-	_, delErr := m.stmtDelete.Exec(sessionID)
-	return delErr
+	if m.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+	m.noteWrite(sessionID)
+	m.dropExpiry(st.table, sessionID)
+	var err error
+	switch {
+	case m.softDelete:
+		_, err = m.execRaw(context.Background(), st.softDelSQL, m.clock.Now().Unix(), sessionID)
+	case m.secureDelete:
+		err = m.scrubAndDelete(st, sessionID)
+	default:
+		_, err = m.execWrite(st.delete, sessionID)
+		if err == nil && m.blobLimit > 0 {
+			err = m.removeBlobs(sessionID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return m.mirrorRow(context.Background(), st, sessionID)
 }
 
-func (m *SQLStore) insert(ctx echo.Context, session *sessions.Session) error {
+// insert writes session as a new row. generated tells that its ID was just
+// generated, so no row can exist under it yet.
+func (m *SQLStore) insert(st *statements, r requestContext, session *sessions.Session, generated bool) error {
 	var modifiedAt int64
 	var createdAt int64
 	var expiredAt int64
-	nowTs := time.Now().Unix()
+	nowTs := m.stamp(m.clock.Now())
 	created := session.Values[m.keyPrefix+"created"]
 	if created == nil {
 		createdAt = nowTs
@@ -222,31 +1269,97 @@ func (m *SQLStore) insert(ctx echo.Context, session *sessions.Session) error {
 	delete(session.Values, m.keyPrefix+"created")
 	delete(session.Values, m.keyPrefix+"expires")
 	delete(session.Values, m.keyPrefix+"modified")
+	delete(session.Values, m.keyPrefix+"stale")
+	delete(session.Values, m.keyPrefix+"digest")
+	delete(session.Values, m.keyPrefix+"inserted")
+	flags := m.popFlags(session)
+	elevated := m.popElevated(session)
+	cookieHash := m.popCookieHash(session)
+	csrfSecret := m.popCSRF(session)
 
-	encoded, err := securecookie.Gob.Serialize(session.Values)
+	var inserted bool
+	err := m.writePayload(r.Context(), st, session, func(st *statements, values map[interface{}]interface{}) error {
+		data, err := m.encodeColumn(values)
+		if err != nil {
+			return err
+		}
+		defer data.release()
+		m.observePayload(r.Context(), session, data.size)
+		if pinned, ok := m.pinnedExpiry(session); ok {
+			expiredAt = pinned
+		} else if expires == nil {
+			expiredAt = nowTs + m.seconds(m.lifetime(r.CookieMaxAge(), session))
+		} else {
+			expiredAt = expires.(int64)
+		}
+		args := []interface{}{session.ID, data.value, m.dbStamp(createdAt), m.dbStamp(modifiedAt), m.dbStamp(expiredAt)}
+		if m.dialect == TiDB {
+			args = append(args, m.fromStamp(expiredAt))
+		}
+		if m.checksum {
+			args = append(args, data.checksum)
+		}
+		if m.flags {
+			args = append(args, int64(flags))
+		}
+		if m.emptyCol {
+			args = append(args, m.emptyFlag(session))
+		}
+		if m.elevatedCol {
+			args = append(args, m.dbStamp(elevated))
+		}
+		if m.cookieHash {
+			args = append(args, cookieHash)
+		}
+		if m.csrfCol {
+			args = append(args, csrfSecret)
+		}
+		args = m.appendPromoted(args, session)
+		args = m.appendEnriched(args, r)
+		if m.instanceCol {
+			args = append(args, m.instanceID)
+		}
+		m.dropExpiry(st.table, session.ID)
+		inserted, err = m.insertRow(st, args, generated)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	if expires == nil {
-		expiredAt = nowTs + int64(m.MaxAge(ctx, session))
-	} else {
-		expiredAt = expires.(int64)
-	}
-	_, insErr := m.stmtInsert.Exec(session.ID, encoded, createdAt, modifiedAt, expiredAt)
-	return insErr
+	session.Values[m.keyPrefix+"inserted"] = inserted
+	m.setExpiresHeader(r, expiredAt)
+	return nil
 }
 
 func (m *SQLStore) Delete(ctx echo.Context, session *sessions.Session) error {
-	sessions.SetCookie(ctx, session.Name(), ``, -1)
+	return m.deleteSession(echoRequest{ctx}, session)
+}
+
+func (m *SQLStore) deleteSession(r requestContext, session *sessions.Session) error {
+	if m.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if len(m.sharedCookie) == 0 {
+		// The shared cookie still carries the sessions of other names.
+		r.RemoveCookie(session.Name())
+	}
+	m.observeDeleted(session)
+	if err := m.removeReplaced(r.Context(), session); err != nil {
+		return err
+	}
 	// Clear session values.
 	for k := range session.Values {
 		delete(session.Values, k)
 	}
-	return m.Remove(session.ID)
+	return m.removeResolved(r.Context(), session.ID)
 }
 
 func (m *SQLStore) MaxAge(ctx echo.Context, session *sessions.Session) int {
-	maxAge := ctx.CookieOptions().MaxAge
+	return m.lifetime(ctx.CookieOptions().MaxAge, session)
+}
+
+// lifetime returns the lifetime of session given the max-age of its cookie.
+func (m *SQLStore) lifetime(maxAge int, session *sessions.Session) int {
 	if maxAge == 0 {
 		if len(session.Values) == 0 {
 			return m.emptyDataAge
@@ -267,13 +1380,19 @@ func (m *SQLStore) MaxLength(l int) {
 	securecookie.SetMaxLength(m.Codecs, l)
 }
 
-func (m *SQLStore) save(ctx echo.Context, session *sessions.Session) error {
+func (m *SQLStore) save(st *statements, r requestContext, session *sessions.Session) error {
 	if session.IsNew {
-		return m.insert(ctx, session)
+		return m.insert(st, r, session, false)
+	}
+	if m.popRotated(session) {
+		if err := m.insert(st, r, session, false); err != nil {
+			return err
+		}
+		return m.deletePrevious(session.ID)
 	}
 	var createdAt int64
 	var expiredAt int64
-	nowTs := time.Now().Unix()
+	nowTs := m.stamp(m.clock.Now())
 	created := session.Values[m.keyPrefix+"created"]
 	if created == nil {
 		createdAt = nowTs
@@ -285,16 +1404,20 @@ func (m *SQLStore) save(ctx echo.Context, session *sessions.Session) error {
 	delete(session.Values, m.keyPrefix+"created")
 	delete(session.Values, m.keyPrefix+"expires")
 	delete(session.Values, m.keyPrefix+"modified")
+	delete(session.Values, m.keyPrefix+"stale")
+	delete(session.Values, m.keyPrefix+"inserted")
+	flags := m.popFlags(session)
+	elevated := m.popElevated(session)
+	cookieHash := m.popCookieHash(session)
+	csrfSecret := m.popCSRF(session)
 
-	maxAge := int64(m.MaxAge(ctx, session))
+	maxAge := m.seconds(m.lifetime(r.CookieMaxAge(), session))
 	if maxAge < 0 {
-		return m.Delete(ctx, session)
-	}
-	encoded, err := securecookie.Gob.Serialize(session.Values)
-	if err != nil {
-		return err
+		return m.deleteSession(r, session)
 	}
-	if expires == nil {
+	if pinned, ok := m.pinnedExpiry(session); ok {
+		expiredAt = pinned
+	} else if expires == nil {
 		expiredAt = nowTs + maxAge
 	} else {
 		expiredAt = expires.(int64)
@@ -302,42 +1425,163 @@ func (m *SQLStore) save(ctx echo.Context, session *sessions.Session) error {
 			expiredAt = nowTs + (maxAge - (expiredAt - nowTs))
 		}
 	}
-	//encoded := string(b)
-	_, updErr := m.stmtUpdate.Exec(encoded, createdAt, expiredAt, session.ID)
-	if updErr != nil {
-		return updErr
+	if m.writeBack > 0 && m.unchanged(session, int64(flags), elevated) {
+		// Only the expiry moves; it is written back with others later.
+		if expires != nil && expiredAt == expires.(int64) {
+			session.Values[m.keyPrefix+"inserted"] = false
+			return nil
+		}
+		if m.queueExpiry(st.table, session.ID, expiredAt) {
+			session.Values[m.keyPrefix+"inserted"] = false
+			m.setExpiresHeader(r, expiredAt)
+			return nil
+		}
 	}
+	m.dropExpiry(st.table, session.ID)
+	var result sql.Result
+	err := m.writePayload(r.Context(), st, session, func(st *statements, values map[interface{}]interface{}) error {
+		data, err := m.encodeColumn(values)
+		if err != nil {
+			return err
+		}
+		defer data.release()
+		m.observePayload(r.Context(), session, data.size)
+		args := []interface{}{data.value, m.dbStamp(createdAt), m.dbStamp(nowTs), m.dbStamp(expiredAt)}
+		if m.dialect == TiDB {
+			args = append(args, m.fromStamp(expiredAt))
+		}
+		if m.checksum {
+			args = append(args, data.checksum)
+		}
+		if m.flags {
+			args = append(args, int64(flags))
+		}
+		if m.emptyCol {
+			args = append(args, m.emptyFlag(session))
+		}
+		if m.elevatedCol {
+			args = append(args, m.dbStamp(elevated))
+		}
+		if m.cookieHash {
+			args = append(args, cookieHash)
+		}
+		if m.csrfCol {
+			args = append(args, csrfSecret)
+		}
+		args = m.appendPromoted(args, session)
+		if m.procs != nil {
+			// Put takes the arguments of an insert.
+			args = append([]interface{}{session.ID}, args...)
+		} else {
+			args = append(args, session.ID)
+		}
+		if m.lastWriteWins {
+			args = append(args, m.dbStamp(nowTs))
+		}
+		result, err = m.execStmt(st, st.update, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if m.lastWriteWins {
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			m.reportErrorCtx(r.Context(), OpSave, session.ID, ErrStaleWrite)
+		}
+	}
+	session.Values[m.keyPrefix+"inserted"] = false
+	m.setExpiresHeader(r, expiredAt)
 	return nil
 }
 
-var ErrSessionExpired = errors.New("Session expired")
+var (
+	ErrSessionExpired  = errors.New("Session expired")
+	ErrCorruptSession  = errors.New("Session data corrupt")
+	ErrStaleWrite      = errors.New("Session modified by a newer write")
+	ErrSessionNotFound = errors.New("Session not found")
+)
 
-func (m *SQLStore) load(session *sessions.Session) error {
-	row := m.stmtSelect.QueryRow(session.ID)
-	sess := sessionRow{}
-	scanErr := row.Scan(&sess.id, &sess.data, &sess.created, &sess.modified, &sess.expires)
+func (m *SQLStore) load(ctx context.Context, st *statements, session *sessions.Session) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+	sess := Row{}
+	var scanErr error
+	if m.replica != nil && !m.recentlyWritten(session.ID) {
+		sess, scanErr = m.selectHedged(st, session.ID)
+	} else {
+		scanErr = m.rowMapper(st.selectRow.QueryRow(session.ID), m.selCols, &sess)
+	}
 	if scanErr != nil {
 		return scanErr
 	}
-	if sess.expires.Int64 < time.Now().Unix() {
-		log.Printf("Session expired on %s, but it is %s now.", time.Unix(sess.expires.Int64, 0), time.Now())
-		return ErrSessionExpired
+	return m.loadRow(ctx, st, session, &sess)
+}
+
+// loadRow restores session from its row sess.
+func (m *SQLStore) loadRow(ctx context.Context, st *statements, session *sessions.Session, sess *Row) error {
+	if sess.DeletedAt > 0 {
+		return sql.ErrNoRows
+	}
+	now := m.clock.Now()
+	var stale bool
+	if sess.Expires < m.stamp(now.Add(-m.clockSkew)) {
+		if sess.Expires < m.stamp(now.Add(-m.clockSkew-m.staleGrace)) {
+			m.logf(ctx, "Session expired on %s, but it is %s now.", m.fromStamp(sess.Expires), now)
+			return ErrSessionExpired
+		}
+		stale = true
+	}
+	err := m.decodeColumn(sess.Data, sess.Checksum, &session.Values)
+	if err == ErrCorruptSession {
+		if m.deleteCorrupt {
+			if _, err := st.delete.Exec(session.ID); err != nil {
+				m.logf(ctx, "unable to delete corrupt session: %v", err)
+				m.reportErrorCtx(ctx, OpLoad, session.ID, err)
+			}
+		}
+		return ErrCorruptSession
 	}
-	err := securecookie.Gob.Deserialize(sess.data.Bytes, &session.Values)
 	if err != nil {
 		return err
 	}
-	session.Values[m.keyPrefix+"created"] = sess.created.Int64
-	session.Values[m.keyPrefix+"modified"] = sess.modified.Int64
-	session.Values[m.keyPrefix+"expires"] = sess.expires.Int64
+	if m.blobLimit > 0 {
+		if err = m.fillBlobs(ctx, session); err != nil {
+			return err
+		}
+	}
+	m.purgeExpiredValues(session)
+	if m.writeBack > 0 {
+		m.markLoaded(session, sess.Flags, sess.ElevatedUntil)
+	}
+	session.Values[m.keyPrefix+"created"] = sess.Created
+	session.Values[m.keyPrefix+"modified"] = sess.Modified
+	session.Values[m.keyPrefix+"expires"] = sess.Expires
+	if m.flags {
+		session.Values[m.keyPrefix+"flags"] = Flags(sess.Flags)
+	}
+	if m.elevatedCol {
+		session.Values[m.keyPrefix+"elevatedUntil"] = sess.ElevatedUntil
+	}
+	if m.csrfCol && len(sess.CSRFSecret) > 0 {
+		session.Values[m.keyPrefix+"csrfSecret"] = sess.CSRFSecret
+	}
+	if stale {
+		expires := m.stamp(now) + m.seconds(m.lifetime(0, session))
+		session.Values[m.keyPrefix+"expires"] = expires
+		session.Values[m.keyPrefix+"stale"] = true
+		m.revalidate(ctx, st, session.ID, expires)
+	}
 	return nil
-
 }
 
 func (m *SQLStore) closeCleanup() {
-	// Invoke a reaper which checks and removes expired sessions periodically.
-	if m.quiteC != nil && m.doneC != nil {
-		m.StopCleanup(m.quiteC, m.doneC)
+	m.mu.Lock()
+	quit, done := m.quiteC, m.doneC
+	m.mu.Unlock()
+	if quit != nil && done != nil {
+		m.StopCleanup(quit, done)
 	}
 }
 
@@ -347,5 +1591,11 @@ func (m *SQLStore) Init() {
 
 func (m *SQLStore) init() {
 	m.closeCleanup()
-	m.quiteC, m.doneC = m.Cleanup(m.checkInterval)
+	// Invoke a reaper which checks and removes expired sessions periodically.
+	quit, done := m.Cleanup(m.checkInterval)
+	m.mu.Lock()
+	m.quiteC, m.doneC = quit, done
+	m.mu.Unlock()
+	m.startHeartbeat()
+	m.startWriteBack()
 }
@@ -0,0 +1,208 @@
+// Package sqlstoretest provides helpers for testing session flows against an
+// in-memory SQLite database instead of a real MySQL server.
+//
+// The package does not link a SQLite driver itself; import one in the test
+// binary, for example:
+//
+//	import _ "github.com/mattn/go-sqlite3"
+package sqlstoretest
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/admpub/securecookie"
+	sqlstore "github.com/coscms/session-sqlstore"
+)
+
+// DriverName is the database/sql driver used to open the in-memory database.
+var DriverName = `sqlite3`
+
+// DDL creates the session table in SQLite. %s is replaced with the table name.
+// The deleted_at column serves Options.SoftDelete.
+const DDL = "CREATE TABLE IF NOT EXISTS %s (" +
+	"id VARCHAR(100) NOT NULL PRIMARY KEY, " +
+	"data BLOB, " +
+	"created INTEGER NOT NULL DEFAULT 0, " +
+	"modified INTEGER NOT NULL DEFAULT 0, " +
+	"expires INTEGER NOT NULL DEFAULT 0, " +
+	"deleted_at INTEGER)"
+
+var dbSeq int64
+
+// Store is a session store backed by a private in-memory database.
+type Store struct {
+	*sqlstore.SQLStore
+	DB    *sql.DB
+	Table string
+	clock sqlstore.Clock
+	tb    testing.TB
+}
+
+// New creates a store on a fresh in-memory database. A nil cfg uses a single
+// random key pair. The dialect is always SQLite. The store and database are
+// closed when the test ends.
+func New(tb testing.TB, cfg *sqlstore.Options) *Store {
+	tb.Helper()
+	if cfg == nil {
+		cfg = &sqlstore.Options{}
+	}
+	if len(cfg.KeyPairs) == 0 {
+		cfg.KeyPairs = [][]byte{securecookie.GenerateRandomKey(32)}
+	}
+	if len(cfg.Table) == 0 {
+		cfg.Table = `session`
+	}
+	cfg.Dialect = sqlstore.SQLite
+	cfg.SetDDL(DDL)
+	dsn := fmt.Sprintf(`file:sqlstoretest%d?mode=memory&cache=shared`, atomic.AddInt64(&dbSeq, 1))
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		tb.Fatalf(`sqlstoretest: open %s: %v`, DriverName, err)
+	}
+	store, err := sqlstore.New(db, cfg)
+	if err != nil {
+		db.Close()
+		tb.Fatalf(`sqlstoretest: new store: %v`, err)
+	}
+	// A single connection keeps the in-memory database alive. It is set after
+	// New so the pool settings of cfg cannot raise it or close it.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	clock := cfg.Clock
+	if clock == nil {
+		clock = sqlstore.SystemClock
+	}
+	s := &Store{SQLStore: store, DB: db, Table: cfg.Table, clock: clock, tb: tb}
+	tb.Cleanup(func() {
+		store.Close()
+		db.Close()
+	})
+	return s
+}
+
+// Row describes a session row inserted by Store.Insert.
+type Row struct {
+	ID       string
+	Values   map[interface{}]interface{}
+	Created  time.Time
+	Modified time.Time
+	Expires  time.Time
+}
+
+// NewRow returns a row for id with no values. Zero timestamps are filled in
+// by Store.Insert: created and modified with the current time and expires
+// one hour later.
+func NewRow(id string) *Row {
+	return &Row{ID: id, Values: map[interface{}]interface{}{}}
+}
+
+// With sets a session value.
+func (r *Row) With(key interface{}, value interface{}) *Row {
+	r.Values[key] = value
+	return r
+}
+
+// ExpiresAt sets the expiry time.
+func (r *Row) ExpiresAt(t time.Time) *Row {
+	r.Expires = t
+	return r
+}
+
+// Insert writes rows directly into the session table, encoded as the store
+// would write them.
+func (s *Store) Insert(rows ...*Row) {
+	s.tb.Helper()
+	now := s.clock.Now()
+	query := "INSERT INTO `" + s.Table + "` (id, data, created, modified, expires) VALUES (?, ?, ?, ?, ?)"
+	for _, r := range rows {
+		data, err := s.EncodeData(r.Values)
+		if err != nil {
+			s.tb.Fatalf(`sqlstoretest: serialize %s: %v`, r.ID, err)
+		}
+		created, modified, expires := r.Created, r.Modified, r.Expires
+		if created.IsZero() {
+			created = now
+		}
+		if modified.IsZero() {
+			modified = created
+		}
+		if expires.IsZero() {
+			expires = now.Add(time.Hour)
+		}
+		if _, err = s.DB.Exec(query, r.ID, data, s.TimeValue(created), s.TimeValue(modified), s.TimeValue(expires)); err != nil {
+			s.tb.Fatalf(`sqlstoretest: insert %s: %v`, r.ID, err)
+		}
+	}
+}
+
+// Lookup returns the stored values and expiry of the session id. ok is false
+// if no row exists or it is soft-deleted.
+func (s *Store) Lookup(id string) (values map[interface{}]interface{}, expires time.Time, ok bool) {
+	s.tb.Helper()
+	var data []byte
+	var expiresAt interface{}
+	err := s.DB.QueryRow("SELECT data, expires FROM `"+s.Table+"` WHERE id = ? AND deleted_at IS NULL", id).Scan(&data, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, time.Time{}, false
+	}
+	if err != nil {
+		s.tb.Fatalf(`sqlstoretest: lookup %s: %v`, id, err)
+	}
+	if values, err = s.DecodeData(data); err != nil {
+		s.tb.Fatalf(`sqlstoretest: decode %s: %v`, id, err)
+	}
+	if expires, err = s.ValueTime(expiresAt); err != nil {
+		s.tb.Fatalf(`sqlstoretest: expiry of %s: %v`, id, err)
+	}
+	return values, expires, true
+}
+
+// AssertExists fails the test if no row exists for the session id.
+func (s *Store) AssertExists(id string) {
+	s.tb.Helper()
+	if _, _, ok := s.Lookup(id); !ok {
+		s.tb.Errorf(`session %q does not exist`, id)
+	}
+}
+
+// AssertNotExists fails the test if a row exists for the session id.
+func (s *Store) AssertNotExists(id string) {
+	s.tb.Helper()
+	if _, _, ok := s.Lookup(id); ok {
+		s.tb.Errorf(`session %q exists`, id)
+	}
+}
+
+// AssertExpired fails the test unless the session id exists and has expired.
+func (s *Store) AssertExpired(id string) {
+	s.tb.Helper()
+	_, expires, ok := s.Lookup(id)
+	if !ok {
+		s.tb.Errorf(`session %q does not exist`, id)
+		return
+	}
+	if now := s.clock.Now(); !expires.Before(now) {
+		s.tb.Errorf(`session %q expires at %s, want before %s`, id, expires, now)
+	}
+}
+
+// AssertValues fails the test unless the stored values of the session id
+// equal want.
+func (s *Store) AssertValues(id string, want map[interface{}]interface{}) {
+	s.tb.Helper()
+	got, _, ok := s.Lookup(id)
+	if !ok {
+		s.tb.Errorf(`session %q does not exist`, id)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		s.tb.Errorf(`session %q values = %v, want %v`, id, got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package sqlstoretest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/admpub/securecookie"
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestInsertedRowLoadsThroughStore(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	keys := [][]byte{securecookie.GenerateRandomKey(32)}
+	s := sqlstoretest.New(t, &sqlstore.Options{KeyPairs: keys, MaxOpenConns: 4, Clock: clock})
+	s.Insert(sqlstoretest.NewRow(`abc`).With(`user`, `alice`))
+	s.AssertValues(`abc`, map[interface{}]interface{}{`user`: `alice`})
+
+	cookie, err := securecookie.EncodeMulti(`SID`, `abc`, securecookie.CodecsFromPairs(keys...)...)
+	if err != nil {
+		t.Fatalf(`EncodeMulti: %v`, err)
+	}
+	r := httptest.NewRequest(http.MethodGet, `/`, nil)
+	r.AddCookie(&http.Cookie{Name: `SID`, Value: cookie})
+	session, err := sqlstore.NewHTTPStore(s.SQLStore, nil).Get(r, `SID`)
+	if err != nil {
+		t.Fatalf(`Get: %v`, err)
+	}
+	if session.IsNew || session.Values[`user`] != `alice` {
+		t.Fatalf(`loaded %v (new: %v), want the inserted row`, session.Values, session.IsNew)
+	}
+}
+
+func TestAssertExpired(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{Clock: clock})
+	s.Insert(sqlstoretest.NewRow(`old`).ExpiresAt(now.Add(-time.Minute)))
+	s.AssertExpired(`old`)
+	s.AssertNotExists(`missing`)
+
+	if _, expires, ok := s.Lookup(`old`); !ok || expires.Unix() != now.Add(-time.Minute).Unix() {
+		t.Fatalf(`Lookup = %v, %v, want the inserted expiry`, expires, ok)
+	}
+}
+
+func TestLookupFollowsTheStoreFormat(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	for _, format := range []string{sqlstore.TimeUnix, sqlstore.TimeDatetime, sqlstore.TimeUnixMilli} {
+		s := sqlstoretest.New(t, &sqlstore.Options{TimeFormat: format, Clock: clock})
+		want := now.Add(30 * time.Minute)
+		s.Insert(sqlstoretest.NewRow(`abc`).ExpiresAt(want))
+		if format != sqlstore.TimeUnixMilli {
+			want = want.Truncate(time.Second)
+		}
+		if _, expires, ok := s.Lookup(`abc`); !ok || !expires.Equal(want) {
+			t.Errorf(`%q: Lookup = %v, %v, want %v`, format, expires, ok, want)
+		}
+	}
+}
+
+func TestLookupSkipsSoftDeletedRows(t *testing.T) {
+	// The pool settings must not close the connection holding the database.
+	s := sqlstoretest.New(t, &sqlstore.Options{SoftDelete: true, ConnMaxLifetime: time.Millisecond, MaxIdleConns: 4})
+	s.Insert(sqlstoretest.NewRow(`abc`))
+	time.Sleep(5 * time.Millisecond)
+	s.AssertExists(`abc`)
+	if err := s.Remove(`abc`); err != nil {
+		t.Fatalf(`Remove: %v`, err)
+	}
+	s.AssertNotExists(`abc`)
+}
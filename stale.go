@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/admpub/sessions"
+)
+
+// Behaviors for Options.ExpiredAccess.
+const (
+	ExpiredStartFresh  = ``
+	ExpiredReturnError = `error`
+)
+
+// IsStale reports whether session expired within Options.StaleGrace and was
+// returned while its renewal runs in the background.
+func (m *SQLStore) IsStale(session *sessions.Session) bool {
+	stale, _ := session.Values[m.keyPrefix+"stale"].(bool)
+	return stale
+}
+
+// revalidate extends the expiry of a stale session to expires in the
+// background, unless a save has already moved it further.
+func (m *SQLStore) revalidate(ctx context.Context, st *statements, sessionID string, expires int64) {
+	if m.readOnly.Load() || !m.allowExtension() {
+		return
+	}
+	if err := m.begin(); err != nil {
+		return
+	}
+	// ctx may be a pooled echo.Context, recycled once the request is done,
+	// so the goroutine only keeps its trace ID.
+	traceID := m.traceOf(ctx)
+	go func() {
+		defer m.end()
+		query := m.dialect.rebind("UPDATE " + st.table + " SET expires = ? WHERE id = ? AND expires < ?")
+		if _, err := m.execRaw(context.Background(), query, m.dbStamp(expires), sessionID, m.dbStamp(expires)); err != nil {
+			logTrace(traceID, "unable to renew stale session: %v", err)
+			m.reportError(OpSave, sessionID, withTrace(traceID, err))
+		}
+	}()
+}
@@ -0,0 +1,57 @@
+package sqlstore_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestStaleRenewalKeepsOnlyTheTraceID(t *testing.T) {
+	sqlstoretest.DriverName = `sqlite3_flaky`
+	defer func() { sqlstoretest.DriverName = `sqlite3` }()
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	// The request context may be recycled once Get returns, so the renewal
+	// running in the background must not read it.
+	var served, lateRead atomic.Bool
+	traceID := func(ctx context.Context) string {
+		if served.Load() {
+			lateRead.Store(true)
+		}
+		return `req-1`
+	}
+	var reported atomic.Value
+	onError := func(op string, sessionID string, err error) { reported.Store(err) }
+	s := sqlstoretest.New(t, &sqlstore.Options{StaleGrace: time.Hour, TraceID: traceID, OnError: onError, Clock: clock})
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+
+	// The renewal fails after the request was served.
+	flaky.Delay.Store(int64(50 * time.Millisecond))
+	flaky.Fail.Store(1)
+	defer flaky.Delay.Store(0)
+	defer flaky.Fail.Store(0)
+	_, expires, _ := s.Lookup(session.ID)
+	now = expires.Add(time.Minute)
+	if _, session = c.get(); !s.IsStale(session) {
+		t.Fatal(`a session within StaleGrace was not returned as stale`)
+	}
+	served.Store(true)
+	if err := s.Close(); err != nil {
+		t.Fatalf(`Close: %v`, err)
+	}
+	if lateRead.Load() {
+		t.Fatal(`the background renewal read the request context`)
+	}
+	var traced *sqlstore.TraceError
+	if err, _ := reported.Load().(error); !errors.As(err, &traced) || traced.TraceID != `req-1` {
+		t.Fatalf(`the failed renewal reported %v, want an error traced to req-1`, err)
+	}
+}
@@ -0,0 +1,401 @@
+package sqlstore
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/admpub/errors"
+)
+
+// DefaultStatementCacheSize is the number of resolved tables whose prepared
+// statements are kept open when Options.TableResolver is set.
+var DefaultStatementCacheSize = 64
+
+// statements are the prepared statements of one session table.
+type statements struct {
+	name       string // unquoted table name, the cache key
+	table      string // quoted table name
+	insert     stmt
+	create     stmt // plain INSERT of generated IDs in Galera mode
+	delete     stmt
+	update     stmt
+	selectRow  stmt
+	softDelSQL string
+	// tx tells that the statements are bound to a transaction, which is
+	// retried as a whole.
+	tx bool
+
+	elem    *list.Element
+	refs    int
+	evicted bool
+}
+
+func (st *statements) close() {
+	for _, stmt := range []stmt{st.selectRow, st.update, st.delete, st.insert, st.create} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// stmt is a statement of a session table: a *sql.Stmt, or a rawStmt in
+// Options.ProxyMode.
+type stmt interface {
+	Exec(args ...interface{}) (sql.Result, error)
+	QueryRow(args ...interface{}) RowScanner
+	Close() error
+}
+
+// preparedStmt is a stmt prepared on the server.
+type preparedStmt struct {
+	*sql.Stmt
+}
+
+func (s preparedStmt) QueryRow(args ...interface{}) RowScanner {
+	return s.Stmt.QueryRow(args...)
+}
+
+// dbConn is a *sql.DB or a *sql.Tx.
+type dbConn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// rawStmt runs its query without preparing it on the server, for proxies
+// that rewrite or do not support prepared statements.
+type rawStmt struct {
+	db    dbConn
+	query string
+}
+
+func (s *rawStmt) Exec(args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(s.query, args...)
+}
+
+func (s *rawStmt) QueryRow(args ...interface{}) RowScanner {
+	return s.db.QueryRow(s.query, args...)
+}
+
+func (s *rawStmt) Close() error {
+	return nil
+}
+
+// inTx returns the write statements of st bound to tx. They run within the
+// slot of Options.MaxConcurrentOps withTx holds.
+func (st *statements) inTx(tx *sql.Tx) *statements {
+	return &statements{
+		name:   st.name,
+		table:  st.table,
+		insert: txStmt(tx, st.insert),
+		create: txStmt(tx, st.create),
+		update: txStmt(tx, st.update),
+		tx:     true,
+	}
+}
+
+// txStmt returns s bound to tx.
+func txStmt(tx *sql.Tx, s stmt) stmt {
+	if limited, ok := s.(limitedStmt); ok {
+		s = limited.stmt
+	}
+	switch s := s.(type) {
+	case preparedStmt:
+		return preparedStmt{tx.Stmt(s.Stmt)}
+	case *rawStmt:
+		return &rawStmt{db: tx, query: s.query}
+	}
+	return s
+}
+
+// prepareStmt prepares query, unless Options.ProxyMode is set.
+func (m *SQLStore) prepareStmt(query string) (stmt, error) {
+	var s stmt
+	if m.proxyMode {
+		s = &rawStmt{db: m.db, query: query}
+	} else {
+		m.ops.acquire()
+		prepared, err := m.db.Prepare(query)
+		m.ops.release()
+		if err != nil {
+			return nil, err
+		}
+		s = preparedStmt{prepared}
+	}
+	if m.ops != nil {
+		s = limitedStmt{stmt: s, ops: m.ops}
+	}
+	return s, nil
+}
+
+// createTable runs the DDL for table. In Options.ProxyMode the DDL is split
+// into single statements.
+func (m *SQLStore) createTable(table string) error {
+	queries := []string{fmt.Sprintf(m.ddl, table)}
+	if m.proxyMode {
+		queries = strings.Split(queries[0], ";")
+	}
+	for _, query := range queries {
+		if len(strings.TrimSpace(query)) == 0 {
+			continue
+		}
+		if _, err := m.execRaw(context.Background(), query); err != nil {
+			return errors.Wrap(err, query)
+		}
+	}
+	return nil
+}
+
+// stmtCache is an LRU cache of the statements of resolved tables. Evicted
+// entries are closed once the last operation using them releases them.
+type stmtCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List
+	entries map[string]*statements
+}
+
+// prepare creates table if needed and prepares its statements.
+func (m *SQLStore) prepare(table string) (*statements, error) {
+	st := &statements{name: table, table: m.dialect.Quote(table)}
+
+	if len(m.ddl) > 0 {
+		if err := m.createTable(st.table); err != nil {
+			return nil, err
+		}
+	}
+	if m.procs != nil {
+		return m.prepareProcedures(st)
+	}
+
+	var err error
+	var extra []string
+	if m.softDelete {
+		// A session saved again under the ID of a soft-deleted row is live.
+		extra = append(extra, "deleted_at = NULL")
+	}
+	insQ := m.dialect.rebind(m.dialect.upsert(st.table, m.insCols, m.softDelete, extra...))
+	if m.galera {
+		// Generated IDs are random; the update path of an upsert only adds
+		// to the write-set. Sessions saved as new under an existing ID,
+		// e.g. expired or soft-deleted ones, still use the upsert.
+		createQ := "INSERT INTO " + st.table + "(" + strings.Join(m.insCols, ", ") + ") VALUES (" + placeholders(len(m.insCols)) + ")"
+		if st.create, err = m.prepareStmt(createQ); err != nil {
+			return nil, errors.Wrap(err, createQ)
+		}
+	}
+	if m.dialect == Postgres {
+		// xmax is only set for a row that was updated.
+		insQ += " RETURNING (xmax = 0)"
+	}
+	if st.insert, err = m.prepareStmt(insQ); err != nil {
+		st.close()
+		return nil, errors.Wrap(err, insQ)
+	}
+
+	delQ := m.dialect.rebind("DELETE FROM " + st.table + " WHERE id = ?")
+	if st.delete, err = m.prepareStmt(delQ); err != nil {
+		st.close()
+		return nil, errors.Wrap(err, delQ)
+	}
+
+	updQ := "UPDATE " + st.table + " SET " + strings.Join(m.updCols, " = ?, ") + " = ? " +
+		"WHERE id = ?"
+	if m.lastWriteWins {
+		updQ += " AND modified <= ?"
+	}
+	updQ = m.dialect.rebind(updQ)
+	if st.update, err = m.prepareStmt(updQ); err != nil {
+		st.close()
+		return nil, errors.Wrap(err, updQ)
+	}
+
+	selQ := m.dialect.rebind("SELECT " + strings.Join(m.selCols, ", ") + " from " +
+		st.table + " WHERE id = ?")
+	if st.selectRow, err = m.prepareStmt(selQ); err != nil {
+		st.close()
+		return nil, errors.Wrap(err, selQ)
+	}
+	if m.softDelete {
+		st.softDelSQL = m.dialect.rebind("UPDATE " + st.table + " SET deleted_at = ? WHERE id = ?")
+	}
+	return st, nil
+}
+
+// acquire returns the statements of the table resolved for ctx, preparing
+// them on first use. Every successful call must be paired with release.
+func (m *SQLStore) acquire(ctx context.Context) (*statements, error) {
+	if m.resolveTable == nil {
+		return m.acquireDefault(), nil
+	}
+	return m.acquireTable(m.resolveTable(ctx))
+}
+
+// acquireDefault returns the statements of the default table. The result
+// must be passed to release.
+func (m *SQLStore) acquireDefault() *statements {
+	c := &m.stmtCache
+	c.mu.Lock()
+	st := m.stmts
+	st.refs++
+	c.mu.Unlock()
+	return st
+}
+
+// current returns the statements of the default table for their table
+// names only; they may be closed by SwitchTable at any time.
+func (m *SQLStore) current() *statements {
+	c := &m.stmtCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return m.stmts
+}
+
+// tableName returns the quoted name of the default table.
+func (m *SQLStore) tableName() string {
+	return m.current().table
+}
+
+// gcExpiredSQL returns the statement deleting the sessions of table that
+// expired before its argument, from Options.GCExpiredSQL if set.
+// Soft-deleted rows are left to purgeDeleted, so they are kept for the
+// retention window.
+func (m *SQLStore) gcExpiredSQL(table string) string {
+	if len(m.gcExpired) > 0 {
+		return m.dialect.rebind(fmt.Sprintf(m.gcExpired, table))
+	}
+	return m.dialect.rebind("DELETE FROM " + table + " WHERE expires < ?" + m.notDeleted())
+}
+
+// acquireTable is like acquire for the named table.
+func (m *SQLStore) acquireTable(table string) (*statements, error) {
+	c := &m.stmtCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(table) == 0 || table == m.stmts.name {
+		m.stmts.refs++
+		return m.stmts, nil
+	}
+	if st, ok := c.entries[table]; ok {
+		c.lru.MoveToFront(st.elem)
+		st.refs++
+		return st, nil
+	}
+	st, err := m.prepare(table)
+	if err != nil {
+		return nil, err
+	}
+	st.refs = 1
+	st.elem = c.lru.PushFront(st)
+	c.entries[table] = st
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Remove(c.lru.Back()).(*statements)
+		delete(c.entries, oldest.name)
+		oldest.evicted = true
+		if oldest.refs == 0 {
+			oldest.close()
+		}
+	}
+	return st, nil
+}
+
+// release returns statements obtained from acquire.
+func (m *SQLStore) release(st *statements) {
+	c := &m.stmtCache
+	c.mu.Lock()
+	st.refs--
+	if st.evicted && st.refs == 0 {
+		st.close()
+	}
+	c.mu.Unlock()
+}
+
+// forget removes the statements of the named table from the cache, e.g.
+// before the table is dropped.
+func (m *SQLStore) forget(table string) {
+	c := &m.stmtCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.entries[table]
+	if !ok {
+		return
+	}
+	c.lru.Remove(st.elem)
+	delete(c.entries, table)
+	st.evicted = true
+	if st.refs == 0 {
+		st.close()
+	}
+}
+
+// closeStatements closes the statements of the default table and of every
+// cached table.
+func (m *SQLStore) closeStatements() {
+	c := &m.stmtCache
+	c.mu.Lock()
+	m.stmts.evicted = true
+	if m.stmts.refs == 0 {
+		m.stmts.close()
+	}
+	for name, st := range c.entries {
+		st.evicted = true
+		if st.refs == 0 {
+			st.close()
+		}
+		delete(c.entries, name)
+	}
+	if c.lru != nil {
+		c.lru.Init()
+	}
+	c.mu.Unlock()
+}
+
+// deleteExpiredCached deletes expired sessions from the cached tables, which
+// the GC strategies of the default table do not cover.
+func (m *SQLStore) deleteExpiredCached(cutoff int64) error {
+	for _, table := range m.cachedTables() {
+		result, err := m.execRaw(context.Background(), m.gcExpiredSQL(table), m.dbStamp(cutoff))
+		if err != nil {
+			return err
+		}
+		m.countDeleted(result)
+	}
+	return nil
+}
+
+// SwitchTable moves the store to the table named table: it creates the
+// table with the DDL if needed, prepares its statements, swaps them in for
+// new operations and closes the old ones once running operations are done.
+// It enables blue/green migrations of the session table without a restart.
+// Sessions are not copied between the tables.
+func (m *SQLStore) SwitchTable(ctx context.Context, table string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	st, err := m.prepare(table)
+	if err != nil {
+		return err
+	}
+	c := &m.stmtCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := m.stmts
+	m.stmts = st
+	old.evicted = true
+	if old.refs == 0 {
+		old.close()
+	}
+	// The new default table must not also live in the cache.
+	if cached, ok := c.entries[table]; ok {
+		c.lru.Remove(cached.elem)
+		delete(c.entries, table)
+		cached.evicted = true
+		if cached.refs == 0 {
+			cached.close()
+		}
+	}
+	return nil
+}
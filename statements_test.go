@@ -0,0 +1,79 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+type tenantKey struct{}
+
+func tenantTable(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	if len(tenant) == 0 {
+		return ``
+	}
+	return `session_` + tenant
+}
+
+func TestTableResolverKeepsTenantsApart(t *testing.T) {
+	// A cache of one table makes every switch of tenant evict the other.
+	s := sqlstoretest.New(t, &sqlstore.Options{TableResolver: tenantTable, StatementCacheSize: 1})
+	tenants := map[string]*client{}
+	for _, tenant := range []string{`a`, `b`} {
+		c := newClient(t, s.SQLStore)
+		c.ctx = context.WithValue(context.Background(), tenantKey{}, tenant)
+		r, session := c.get()
+		session.Values[`tenant`] = tenant
+		c.save(r, session)
+		tenants[tenant] = c
+	}
+
+	for tenant, c := range tenants {
+		_, session := c.get()
+		if session.IsNew || session.Values[`tenant`] != tenant {
+			t.Fatalf(`tenant %s loaded %v (new: %v)`, tenant, session.Values, session.IsNew)
+		}
+		for _, table := range []string{`session`, `session_a`, `session_b`} {
+			var n int
+			if err := s.DB.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE id = ?`, session.ID).Scan(&n); err != nil {
+				t.Fatalf(`count %s: %v`, table, err)
+			}
+			if want := table == `session_`+tenant; (n == 1) != want {
+				t.Errorf(`table %s holds %d rows of tenant %s`, table, n, tenant)
+			}
+		}
+	}
+
+	// A request without a tenant uses Table and does not see their sessions.
+	c := tenants[`a`].clone()
+	c.ctx = context.Background()
+	if _, session := c.get(); !session.IsNew {
+		t.Fatalf(`a request without a tenant loaded %v`, session.Values)
+	}
+}
+
+func TestTableResolverHelpersCoverCachedTables(t *testing.T) {
+	s := sqlstoretest.New(t, &sqlstore.Options{TableResolver: tenantTable})
+	ctx := context.Background()
+	var ids []string
+	for _, tenant := range []string{``, `a`, `b`} {
+		c := newClient(t, s.SQLStore)
+		c.ctx = context.WithValue(ctx, tenantKey{}, tenant)
+		r, session := c.get()
+		c.save(r, session)
+		ids = append(ids, session.ID)
+	}
+
+	if n, err := s.ActiveSince(ctx, time.Now().Add(-time.Minute)); err != nil || n != 3 {
+		t.Fatalf(`ActiveSince = %d, %v, want the sessions of every table`, n, err)
+	}
+	for _, id := range ids {
+		if _, err := s.TTL(ctx, id); err != nil {
+			t.Fatalf(`TTL(%s): %v`, id, err)
+		}
+	}
+}
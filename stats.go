@@ -0,0 +1,79 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/admpub/sessions"
+)
+
+// Stats is a snapshot of the store's counters since it was created.
+type Stats struct {
+	Payloads      int64 // payloads written
+	PayloadBytes  int64 // total size of written payloads
+	MaxPayload    int64 // largest payload written
+	LargePayloads int64 // payloads above Options.PayloadWarnSize
+	// Lifetimes of the sessions ended by Delete and, with
+	// Options.TrackLifetimes, by GC.
+	Lifetimes Lifetimes
+	// CleanupRuns are the most recent cleanup passes, oldest first.
+	CleanupRuns []CleanupRun
+	// DecodeFailures counts the session cookies that could not be decoded
+	// by category, e.g. DecodeBadSignature.
+	DecodeFailures map[string]int64
+}
+
+type stats struct {
+	payloads      atomic.Int64
+	payloadBytes  atomic.Int64
+	maxPayload    atomic.Int64
+	largePayloads atomic.Int64
+	lifetimes     [len(LifetimeBuckets) + 1]atomic.Int64
+	lastGC        atomic.Int64
+	decodeFails   [len(decodeCategories)]atomic.Int64
+}
+
+// Stats returns a snapshot of the store's counters.
+func (m *SQLStore) Stats() Stats {
+	s := Stats{
+		Payloads:      m.stats.payloads.Load(),
+		PayloadBytes:  m.stats.payloadBytes.Load(),
+		MaxPayload:    m.stats.maxPayload.Load(),
+		LargePayloads: m.stats.largePayloads.Load(),
+		CleanupRuns:   m.cleanups.list(),
+	}
+	for i := range m.stats.lifetimes {
+		s.Lifetimes[i] = m.stats.lifetimes[i].Load()
+	}
+	s.DecodeFailures = make(map[string]int64, len(decodeCategories))
+	for i, category := range decodeCategories {
+		s.DecodeFailures[category] = m.stats.decodeFails[i].Load()
+	}
+	return s
+}
+
+// observePayload records the serialized size of a payload about to be saved.
+func (m *SQLStore) observePayload(ctx context.Context, session *sessions.Session, size int) {
+	n := int64(size)
+	m.stats.payloads.Add(1)
+	m.stats.payloadBytes.Add(n)
+	for {
+		cur := m.stats.maxPayload.Load()
+		if n <= cur || m.stats.maxPayload.CompareAndSwap(cur, n) {
+			break
+		}
+	}
+	if m.observeSize != nil {
+		m.observeSize(size)
+	}
+	if m.payloadWarn > 0 && size > m.payloadWarn {
+		m.stats.largePayloads.Add(1)
+		keys := make([]string, 0, len(session.Values))
+		for k := range session.Values {
+			keys = append(keys, fmt.Sprint(k))
+		}
+		m.logf(ctx, "session %q payload is %d bytes, above the warning threshold of %d; keys: %v",
+			session.Name(), size, m.payloadWarn, keys)
+	}
+}
@@ -0,0 +1,136 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+)
+
+// sessionTables returns the quoted names of the tables sessions may be
+// stored in: the current and previous period's tables under
+// Options.Rotation, otherwise the default table followed by the resolved
+// tables in the statement cache of Options.TableResolver.
+func (m *SQLStore) sessionTables() ([]string, error) {
+	if len(m.rotation) == 0 {
+		return append([]string{m.tableName()}, m.cachedTables()...), nil
+	}
+	now := m.clock.Now()
+	tables := make([]string, 0, 2)
+	for back := 0; back <= 1; back++ {
+		// Acquiring creates the table of a period that saw no session yet.
+		st, err := m.acquireTable(m.rotatedTable(now, back))
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, st.table)
+		m.release(st)
+	}
+	return tables, nil
+}
+
+// cachedTables returns the quoted names of the tables in the statement
+// cache.
+func (m *SQLStore) cachedTables() []string {
+	c := &m.stmtCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tables := make([]string, 0, len(c.entries))
+	for _, st := range c.entries {
+		tables = append(tables, st.table)
+	}
+	return tables
+}
+
+// countTables sums the count selected by the query built for each session
+// table.
+func (m *SQLStore) countTables(ctx context.Context, query func(table string) string, args ...interface{}) (int64, error) {
+	tables, err := m.sessionTables()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, table := range tables {
+		var n int64
+		if err = m.queryRow(ctx, query(table), args...).Scan(&n); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// execTables runs the statement built for each session table and returns
+// the total number of affected rows.
+func (m *SQLStore) execTables(ctx context.Context, query func(table string) string, args ...interface{}) (int64, error) {
+	tables, err := m.sessionTables()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, table := range tables {
+		result, err := m.exec(ctx, query(table), args...)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// scanFirst scans the row selected by the query built for each session
+// table into dest, stopping at the first table that has one. It fails with
+// sql.ErrNoRows if none has.
+func (m *SQLStore) scanFirst(ctx context.Context, query func(table string) string, args []interface{}, dest ...interface{}) error {
+	tables, err := m.sessionTables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err = m.queryRow(ctx, query(table), args...).Scan(dest...); err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// listTables returns page of the sessions listed by the query built for
+// each session table, which must be ordered like less. With several tables,
+// each is read up to the end of the page and the results are merged.
+func (m *SQLStore) listTables(ctx context.Context, query func(table string) string, args []interface{}, page Page, less func(a, b *SessionInfo) bool) ([]SessionInfo, error) {
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageLimit
+	}
+	tables, err := m.sessionTables()
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 1 {
+		rows, err := m.query(ctx, query(tables[0])+" LIMIT "+strconv.Itoa(page.Limit)+" OFFSET "+strconv.Itoa(page.Offset), args...)
+		if err != nil {
+			return nil, err
+		}
+		return m.scanSessionInfos(rows)
+	}
+	var list []SessionInfo
+	for _, table := range tables {
+		rows, err := m.query(ctx, query(table)+" LIMIT "+strconv.Itoa(page.Offset+page.Limit), args...)
+		if err != nil {
+			return nil, err
+		}
+		part, err := m.scanSessionInfos(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, part...)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return less(&list[i], &list[j]) })
+	if page.Offset >= len(list) {
+		return nil, nil
+	}
+	return list[page.Offset:min(len(list), page.Offset+page.Limit)], nil
+}
@@ -0,0 +1,77 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TableStats describes the session table, to tune MaxAge, the cleanup
+// interval and MaxRows.
+type TableStats struct {
+	Rows int64 `json:"rows"`
+	// AvgPayload is the average size of the data column in bytes.
+	AvgPayload float64 `json:"avgPayload"`
+	// Expired is the number of expired rows not yet removed by GC.
+	Expired int64 `json:"expired"`
+	// CreatedPerHour is the average number of sessions created per hour
+	// over the last day.
+	CreatedPerHour float64 `json:"createdPerHour"`
+	// GrowthPerHour is the change of Rows per hour since the previous call
+	// of TableStats, zero on the first.
+	GrowthPerHour float64 `json:"growthPerHour"`
+}
+
+// tableSnapshot is the row count seen by the previous TableStats call.
+type tableSnapshot struct {
+	mu   sync.Mutex
+	rows int64
+	at   time.Time
+}
+
+// TableStats returns statistics of the session tables. It scans them whole,
+// so call it sparingly on large tables.
+func (m *SQLStore) TableStats(ctx context.Context) (TableStats, error) {
+	var s TableStats
+	now := m.clock.Now()
+	tables, err := m.sessionTables()
+	if err != nil {
+		return s, err
+	}
+	var created int64
+	var payload float64
+	for _, table := range tables {
+		var t TableStats
+		var n int64
+		query := "SELECT COUNT(*), COALESCE(AVG(LENGTH(data)), 0), " +
+			"COALESCE(SUM(CASE WHEN expires < ? THEN 1 ELSE 0 END), 0), " +
+			"COALESCE(SUM(CASE WHEN created >= ? THEN 1 ELSE 0 END), 0) FROM " + table
+		if m.softDelete {
+			query += " WHERE" + strings.TrimPrefix(m.notDeleted(), " AND")
+		}
+		err = m.queryRow(ctx, query, m.dbTime(now), m.dbTime(now.Add(-24*time.Hour))).
+			Scan(&t.Rows, &t.AvgPayload, &t.Expired, &n)
+		if err != nil {
+			return s, err
+		}
+		s.Rows += t.Rows
+		s.Expired += t.Expired
+		payload += t.AvgPayload * float64(t.Rows)
+		created += n
+	}
+	if s.Rows > 0 {
+		s.AvgPayload = payload / float64(s.Rows)
+	}
+	s.CreatedPerHour = float64(created) / 24
+	snap := &m.tableSnap
+	snap.mu.Lock()
+	if !snap.at.IsZero() {
+		if hours := now.Sub(snap.at).Hours(); hours > 0 {
+			s.GrowthPerHour = float64(s.Rows-snap.rows) / hours
+		}
+	}
+	snap.rows, snap.at = s.Rows, now
+	snap.mu.Unlock()
+	return s, nil
+}
@@ -0,0 +1,121 @@
+package sqlstore
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Storage formats of the created, modified and expires columns for
+// Options.TimeFormat.
+const (
+	// TimeUnix stores UTC unix seconds in integer columns, the default.
+	TimeUnix = ``
+	// TimeDatetime stores times in DATETIME or TIMESTAMP columns, written
+	// in Options.TimeLocation. With MySQL use parseTime=true and a loc
+	// matching TimeLocation. Expiry math is done on unix times, so app
+	// servers in different time zones agree.
+	TimeDatetime = `datetime`
+	// TimeUnixMilli stores unix milliseconds in integer columns, so short
+	// sessions expire exactly and saves within a second keep their order.
+	// The columns must be BIGINT. The session meta values, Row and GC
+	// cutoffs are in milliseconds too.
+	TimeUnixMilli = `unixmilli`
+)
+
+// stamp returns t in the unit of the time columns: unix milliseconds with
+// TimeUnixMilli, unix seconds otherwise.
+func (m *SQLStore) stamp(t time.Time) int64 {
+	if m.timeFormat == TimeUnixMilli {
+		return t.UnixMilli()
+	}
+	return t.Unix()
+}
+
+// fromStamp is the inverse of stamp.
+func (m *SQLStore) fromStamp(ts int64) time.Time {
+	if m.timeFormat == TimeUnixMilli {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
+
+// seconds converts n seconds to the unit of stamp.
+func (m *SQLStore) seconds(n int) int64 {
+	if m.timeFormat == TimeUnixMilli {
+		return int64(n) * 1000
+	}
+	return int64(n)
+}
+
+// dbTime converts t to the value stored in a time column.
+func (m *SQLStore) dbTime(t time.Time) interface{} {
+	if m.timeFormat == TimeDatetime {
+		return t.In(m.timeLoc)
+	}
+	return m.stamp(t)
+}
+
+// TimeValue converts t to the value the store writes to its time columns.
+func (m *SQLStore) TimeValue(t time.Time) interface{} {
+	return m.dbTime(t)
+}
+
+// ValueTime is the inverse of TimeValue: it converts the content of a time
+// column, as scanned by database/sql, to a time.
+func (m *SQLStore) ValueTime(v interface{}) (time.Time, error) {
+	var u unixTime
+	if err := u.Scan(v); err != nil {
+		return time.Time{}, err
+	}
+	return m.fromStamp(u.ts), nil
+}
+
+// dbStamp converts the stamp ts to the value stored in a time column.
+func (m *SQLStore) dbStamp(ts int64) interface{} {
+	if m.timeFormat == TimeDatetime {
+		return m.dbTime(m.fromStamp(ts))
+	}
+	return ts
+}
+
+// unixTime scans a time column into a stamp: integers are taken as they
+// are and datetimes converted to unix seconds. Text datetimes without a
+// zone are read as UTC.
+type unixTime struct {
+	ts int64
+}
+
+func (u *unixTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		u.ts = 0
+	case int64:
+		u.ts = v
+	case float64:
+		u.ts = int64(v)
+	case time.Time:
+		u.ts = v.Unix()
+	case []byte:
+		return u.parse(string(v))
+	case string:
+		return u.parse(v)
+	default:
+		return fmt.Errorf("sqlstore: cannot scan %T into a time", src)
+	}
+	return nil
+}
+
+func (u *unixTime) parse(s string) error {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		u.ts = sec
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			u.ts = t.Unix()
+			return nil
+		}
+	}
+	return fmt.Errorf("sqlstore: cannot parse time %q", s)
+}
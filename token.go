@@ -0,0 +1,23 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/admpub/errors"
+)
+
+var ErrNoTokenKey = errors.New("sqlstore: Options.TokenKey is not set")
+
+// FindByToken returns the ID of the live session whose `token` column, set
+// from the value under Options.TokenKey, equals token. It fails with
+// sql.ErrNoRows if there is no such session.
+func (m *SQLStore) FindByToken(ctx context.Context, token string) (string, error) {
+	if len(m.tokenKey) == 0 {
+		return ``, ErrNoTokenKey
+	}
+	var id string
+	err := m.scanFirst(ctx, func(table string) string {
+		return "SELECT id FROM " + table + " WHERE token = ? AND expires >= ?" + m.notDeleted()
+	}, []interface{}{token, m.dbTime(m.clock.Now())}, &id)
+	return id, err
+}
@@ -0,0 +1,74 @@
+package sqlstore
+
+import (
+	"context"
+	"log"
+
+	"github.com/webx-top/echo"
+)
+
+// TraceError is the error passed to the hooks of a request when
+// Options.TraceID is set. It unwraps to Err.
+type TraceError struct {
+	TraceID string
+	Err     error
+}
+
+func (e *TraceError) Error() string {
+	return "trace " + e.TraceID + ": " + e.Err.Error()
+}
+
+func (e *TraceError) Unwrap() error {
+	return e.Err
+}
+
+// TraceHeader returns an Options.TraceID function reading the named request
+// header, e.g. "X-Request-Id", from an echo context.
+func TraceHeader(name string) func(ctx context.Context) string {
+	return func(ctx context.Context) string {
+		if c, ok := ctx.(echo.Context); ok {
+			return c.Header(name)
+		}
+		return ``
+	}
+}
+
+// traceOf returns the trace ID of ctx, or "" if there is none.
+func (m *SQLStore) traceOf(ctx context.Context) string {
+	if m.traceID == nil || ctx == nil {
+		return ``
+	}
+	return m.traceID(ctx)
+}
+
+// traced wraps err in a TraceError carrying the trace ID of ctx, if any.
+func (m *SQLStore) traced(ctx context.Context, err error) error {
+	return withTrace(m.traceOf(ctx), err)
+}
+
+// withTrace wraps err in a TraceError carrying traceID, if set.
+func withTrace(traceID string, err error) error {
+	if len(traceID) == 0 {
+		return err
+	}
+	return &TraceError{TraceID: traceID, Err: err}
+}
+
+// reportErrorCtx is reportError for an error raised while handling the
+// request of ctx.
+func (m *SQLStore) reportErrorCtx(ctx context.Context, op string, sessionID string, err error) {
+	m.reportError(op, sessionID, m.traced(ctx, err))
+}
+
+// logf logs a message about the request of ctx, tagged with its trace ID.
+func (m *SQLStore) logf(ctx context.Context, format string, args ...interface{}) {
+	logTrace(m.traceOf(ctx), format, args...)
+}
+
+// logTrace logs a message tagged with traceID, if set.
+func logTrace(traceID string, format string, args ...interface{}) {
+	if len(traceID) > 0 {
+		format = "[trace " + traceID + "] " + format
+	}
+	log.Printf("sessions: sqlstore: "+format, args...)
+}
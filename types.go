@@ -0,0 +1,53 @@
+package sqlstore
+
+import (
+	"encoding/gob"
+	"reflect"
+	"sync"
+
+	"github.com/admpub/errors"
+)
+
+var sessionTypes = struct {
+	sync.Mutex
+	samples map[reflect.Type]interface{}
+}{samples: map[reflect.Type]interface{}{}}
+
+// RegisterSessionType registers the concrete type of v with encoding/gob so
+// values of that type can be stored in sessions. Registering a type again
+// is a no-op. Every store checks on New that its serializer round-trips the
+// registered types, so a "gob: type not registered" or a lossy serializer
+// surfaces at startup instead of on the first save.
+func RegisterSessionType(v interface{}) {
+	t := reflect.TypeOf(v)
+	sessionTypes.Lock()
+	defer sessionTypes.Unlock()
+	if _, ok := sessionTypes.samples[t]; ok {
+		return
+	}
+	gob.Register(v)
+	sessionTypes.samples[t] = v
+}
+
+// checkSessionTypes round-trips a sample of every registered type through
+// the serializer of the store.
+func (m *SQLStore) checkSessionTypes() error {
+	sessionTypes.Lock()
+	defer sessionTypes.Unlock()
+	for t, sample := range sessionTypes.samples {
+		encoded, release, err := m.encodeValues(map[interface{}]interface{}{`v`: sample})
+		if err != nil {
+			return errors.Wrapf(err, "sqlstore: cannot serialize %v", t)
+		}
+		decoded := map[interface{}]interface{}{}
+		err = m.decodeValues(encoded, &decoded)
+		release()
+		if err != nil {
+			return errors.Wrapf(err, "sqlstore: cannot deserialize %v", t)
+		}
+		if got := reflect.TypeOf(decoded[`v`]); got != t {
+			return errors.Errorf("sqlstore: %v deserializes as %v", t, got)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package sqlstore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// GetValue returns the value of key in session as a T. It reports false if
+// the key is missing or holds another type.
+func GetValue[T any](session *sessions.Session, key interface{}) (T, bool) {
+	v, ok := session.Values[key].(T)
+	return v, ok
+}
+
+// SetValue sets the value of key in session.
+func SetValue[T any](session *sessions.Session, key interface{}, value T) {
+	session.Values[key] = value
+}
+
+// MustGet is like GetValue but panics with a descriptive message if the key
+// is missing or holds another type.
+func MustGet[T any](session *sessions.Session, key interface{}) T {
+	v, ok := GetValue[T](session, key)
+	if !ok {
+		panic(fmt.Sprintf("sqlstore: session value %v is %T, not %T", key, session.Values[key], v))
+	}
+	return v
+}
+
+// CreatedAt returns the creation time of a loaded session.
+func (m *SQLStore) CreatedAt(session *sessions.Session) (time.Time, bool) {
+	return m.metaTime(session.Values[m.keyPrefix+"created"])
+}
+
+// ModifiedAt returns the time a loaded session was last saved.
+func (m *SQLStore) ModifiedAt(session *sessions.Session) (time.Time, bool) {
+	return m.metaTime(session.Values[m.keyPrefix+"modified"])
+}
+
+// ExpiresAt returns the expiry of a loaded session.
+func (m *SQLStore) ExpiresAt(session *sessions.Session) (time.Time, bool) {
+	return m.metaTime(session.Values[m.keyPrefix+"expires"])
+}
+
+// metaTime converts a timestamp meta value to a time.
+func (m *SQLStore) metaTime(v interface{}) (time.Time, bool) {
+	switch ts := v.(type) {
+	case int64:
+		return m.fromStamp(ts), true
+	case int:
+		return m.fromStamp(int64(ts)), true
+	case float64:
+		return m.fromStamp(int64(ts)), true
+	}
+	return time.Time{}, false
+}
+
+// valueTTLPrefix prefixes the meta keys holding the deadlines of values set
+// with SetWithTTL.
+const valueTTLPrefix = `ttl.`
+
+// SetWithTTL sets key in session to value, which is removed on the first
+// load or save after ttl has passed, e.g. for an elevated privileges flag.
+// Setting key again with SetWithTTL moves the deadline.
+func (m *SQLStore) SetWithTTL(session *sessions.Session, key string, value interface{}, ttl time.Duration) {
+	session.Values[key] = value
+	session.Values[m.keyPrefix+valueTTLPrefix+key] = m.stamp(m.clock.Now().Add(ttl))
+}
+
+// purgeExpiredValues removes the values whose SetWithTTL deadline passed,
+// and the deadlines of values removed by the application.
+func (m *SQLStore) purgeExpiredValues(session *sessions.Session) {
+	prefix := m.keyPrefix + valueTTLPrefix
+	now := m.stamp(m.clock.Now())
+	for k, v := range session.Values {
+		meta, ok := k.(string)
+		if !ok || !strings.HasPrefix(meta, prefix) {
+			continue
+		}
+		key := meta[len(prefix):]
+		deadline, _ := v.(int64)
+		if _, set := session.Values[key]; !set || deadline <= now {
+			delete(session.Values, key)
+			delete(session.Values, meta)
+		}
+	}
+}
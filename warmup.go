@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// WarmUp reads the n most recently modified live sessions, e.g. right after
+// a deploy. The store keeps no session cache of its own, so this warms the
+// statements of the resolved table and the database's buffer pool, where a
+// fresh instance would otherwise take its first misses. It returns the number
+// of sessions read; n <= 0 reads nothing.
+func (m *SQLStore) WarmUp(ctx context.Context, n int) (int, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+	if err := m.begin(); err != nil {
+		return 0, err
+	}
+	defer m.end()
+	st, err := m.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.release(st)
+	rows, err := m.query(ctx, "SELECT "+strings.Join(m.selCols, ", ")+" FROM "+st.table+
+		" WHERE expires >= ? ORDER BY modified DESC LIMIT "+strconv.Itoa(n), m.dbTime(m.clock.Now()))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var read int
+	for rows.Next() {
+		sess := Row{}
+		if err = m.rowMapper(rows, m.selCols, &sess); err != nil {
+			return read, err
+		}
+		read++
+	}
+	return read, rows.Err()
+}
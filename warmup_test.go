@@ -0,0 +1,29 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestWarmUpReadsRecentLiveSessions(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{Clock: clock})
+	for i, id := range []string{`a`, `b`, `c`} {
+		row := sqlstoretest.NewRow(id)
+		row.Modified = now.Add(-time.Duration(i) * time.Minute)
+		s.Insert(row)
+	}
+	s.Insert(sqlstoretest.NewRow(`expired`).ExpiresAt(now.Add(-time.Minute)))
+
+	for _, tc := range []struct{ n, want int }{{0, 0}, {2, 2}, {10, 3}} {
+		read, err := s.WarmUp(context.Background(), tc.n)
+		if err != nil || read != tc.want {
+			t.Errorf(`WarmUp(%d) = %d, %v, want %d`, tc.n, read, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/admpub/sessions"
+)
+
+// expiryBatch is the number of sessions updated per statement by a flush
+// of the expiry write-back.
+const expiryBatch = 500
+
+// expiryQueue holds the expiry extensions waiting to be written back, by
+// quoted table and session ID.
+type expiryQueue struct {
+	mu      sync.Mutex
+	pending map[string]map[string]int64
+	quit    chan struct{}
+	done    chan struct{}
+
+	// flushing is held while a flush writes the extensions it took.
+	flushing sync.Mutex
+}
+
+// valuesDigest hashes the values of session with its flags and elevation,
+// independently of the map order of the serializer, so that a save can tell
+// whether anything besides the expiry changed since the load.
+func (m *SQLStore) valuesDigest(session *sessions.Session, flags int64, elevated int64) (uint64, bool) {
+	keys := make([]string, 0, len(session.Values))
+	values := make(map[string]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		key := fmt.Sprint(k)
+		if key == m.keyPrefix+"digest" {
+			continue
+		}
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, key := range keys {
+		data, err := m.serializeValue(key, values[key])
+		if err != nil {
+			return 0, false
+		}
+		h.Write([]byte(key))
+		h.Write(data)
+	}
+	h.Write([]byte(strconv.FormatInt(flags, 10) + "/" + strconv.FormatInt(elevated, 10)))
+	return h.Sum64(), true
+}
+
+// markLoaded records the digest of a freshly loaded session.
+func (m *SQLStore) markLoaded(session *sessions.Session, flags int64, elevated int64) {
+	if digest, ok := m.valuesDigest(session, flags, elevated); ok {
+		session.Values[m.keyPrefix+"digest"] = digest
+	}
+}
+
+// unchanged reports whether session still has the digest it was loaded
+// with, and removes the digest from its values.
+func (m *SQLStore) unchanged(session *sessions.Session, flags int64, elevated int64) bool {
+	loaded, ok := session.Values[m.keyPrefix+"digest"].(uint64)
+	delete(session.Values, m.keyPrefix+"digest")
+	if !ok {
+		return false
+	}
+	digest, ok := m.valuesDigest(session, flags, elevated)
+	return ok && digest == loaded
+}
+
+// queueExpiry queues the new expiry of sessionID in table for the next
+// flush. It returns false if the write-back is not running.
+func (m *SQLStore) queueExpiry(table string, sessionID string, expires int64) bool {
+	q := &m.expiryQ
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.quit == nil {
+		return false
+	}
+	ids, ok := q.pending[table]
+	if !ok {
+		ids = map[string]int64{}
+		q.pending[table] = ids
+	}
+	ids[sessionID] = expires
+	return true
+}
+
+// dropExpiry removes a queued expiry extension of sessionID, whose row is
+// being written in full or removed.
+func (m *SQLStore) dropExpiry(table string, sessionID string) {
+	if m.writeBack <= 0 {
+		return
+	}
+	q := &m.expiryQ
+	q.mu.Lock()
+	delete(q.pending[table], sessionID)
+	q.mu.Unlock()
+}
+
+// dropExpiryAll removes the queued expiry extensions of sessionID in every
+// table before its expiry is set outright, waiting for a running flush, so
+// that a shortened expiry is not extended again.
+func (m *SQLStore) dropExpiryAll(sessionID string) {
+	if m.writeBack <= 0 {
+		return
+	}
+	q := &m.expiryQ
+	q.flushing.Lock()
+	defer q.flushing.Unlock()
+	q.mu.Lock()
+	for _, ids := range q.pending {
+		delete(ids, sessionID)
+	}
+	q.mu.Unlock()
+}
+
+// clearExpiries discards every queued expiry extension, waiting for a
+// running flush. Live sessions queue theirs again on their next save.
+func (m *SQLStore) clearExpiries() {
+	if m.writeBack <= 0 {
+		return
+	}
+	q := &m.expiryQ
+	q.flushing.Lock()
+	defer q.flushing.Unlock()
+	q.mu.Lock()
+	q.pending = map[string]map[string]int64{}
+	q.mu.Unlock()
+}
+
+// flushExpiries writes the queued expiry extensions back, several sessions
+// per UPDATE. A row is only extended while it is live and not deleted, so
+// a session invalidated or removed in the meantime stays so.
+func (m *SQLStore) flushExpiries() {
+	q := &m.expiryQ
+	q.flushing.Lock()
+	defer q.flushing.Unlock()
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = map[string]map[string]int64{}
+	q.mu.Unlock()
+	for table, ids := range pending {
+		args := make([]interface{}, 0, expiryBatch*5+1)
+		var in []interface{}
+		flush := func() {
+			cases := "CASE id" + strings.Repeat(" WHEN ? THEN ?", len(in)) + " END"
+			query := "UPDATE " + table + " SET expires = " + cases + " WHERE id IN (" + placeholders(len(in)) + ")" +
+				" AND expires >= ? AND expires < " + cases + m.notDeleted()
+			all := append(append(append(args, in...), m.dbTime(m.clock.Now())), args...)
+			if _, err := m.exec(context.Background(), query, all...); err != nil {
+				m.logf(context.Background(), "unable to write back session expiries: %v", err)
+				m.reportError(OpSave, ``, err)
+			}
+			args, in = args[:0], in[:0]
+		}
+		for id, expires := range ids {
+			args = append(args, id, m.dbStamp(expires))
+			in = append(in, id)
+			if len(in) == expiryBatch {
+				flush()
+			}
+		}
+		if len(in) > 0 {
+			flush()
+		}
+	}
+}
+
+// startWriteBack starts flushing expiry extensions every
+// Options.ExpiryWriteBack.
+func (m *SQLStore) startWriteBack() {
+	if m.writeBack <= 0 {
+		return
+	}
+	q := &m.expiryQ
+	q.mu.Lock()
+	q.pending = map[string]map[string]int64{}
+	q.quit, q.done = make(chan struct{}), make(chan struct{})
+	quit, done := q.quit, q.done
+	q.mu.Unlock()
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(m.writeBack)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				m.flushExpiries()
+			}
+		}
+	}()
+}
+
+// stopWriteBack stops the write-back and flushes what is still queued.
+func (m *SQLStore) stopWriteBack() {
+	q := &m.expiryQ
+	q.mu.Lock()
+	quit, done := q.quit, q.done
+	q.quit, q.done = nil, nil
+	q.mu.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+	m.flushExpiries()
+}
@@ -0,0 +1,96 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlstore "github.com/coscms/session-sqlstore"
+	"github.com/coscms/session-sqlstore/sqlstoretest"
+)
+
+func TestWriteBackDefersExpiryOnlySaves(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{ExpiryWriteBack: time.Hour, Clock: clock})
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+
+	// A save changing a value is written at once.
+	r, session = c.get()
+	session.Values[`user`] = `bob`
+	c.save(r, session)
+	values, saved, _ := s.Lookup(session.ID)
+	if values[`user`] != `bob` {
+		t.Fatalf(`stored %v after a changed save, want user bob`, values)
+	}
+
+	// An unchanged save past half the lifetime only queues the extension.
+	now = now.Add(saved.Sub(now) * 3 / 4)
+	r, session = c.get()
+	c.save(r, session)
+	if _, expires, _ := s.Lookup(session.ID); !expires.Equal(saved) {
+		t.Fatalf(`an expiry-only save wrote %v at once, want the write deferred`, expires)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf(`Close: %v`, err)
+	}
+	if _, expires, _ := s.Lookup(session.ID); !expires.After(saved) {
+		t.Fatalf(`Close left the expiry at %v, want the queued extension past %v`, expires, saved)
+	}
+}
+
+func TestWriteBackKeepsInvalidatedSessionExpired(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{ExpiryWriteBack: time.Hour, Clock: clock})
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+
+	// An unchanged save past half the lifetime queues an extension.
+	_, expires, _ := s.Lookup(session.ID)
+	now = now.Add(expires.Sub(now) * 3 / 4)
+	r, session = c.get()
+	c.save(r, session)
+
+	if _, err := s.InvalidateCreatedBefore(context.Background(), now.Add(time.Second)); err != nil {
+		t.Fatalf(`InvalidateCreatedBefore: %v`, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf(`Close: %v`, err)
+	}
+	s.AssertExpired(session.ID)
+}
+
+func TestWriteBackKeepsShortenedExpiry(t *testing.T) {
+	now := time.Now()
+	clock := sqlstore.ClockFunc(func() time.Time { return now })
+	s := sqlstoretest.New(t, &sqlstore.Options{ExpiryWriteBack: time.Hour, Clock: clock})
+	c := newClient(t, s.SQLStore)
+	r, session := c.get()
+	session.Values[`user`] = `alice`
+	c.save(r, session)
+
+	// An unchanged save past half the lifetime queues an extension, then
+	// the expiry is shortened.
+	_, expires, _ := s.Lookup(session.ID)
+	now = now.Add(expires.Sub(now) * 3 / 4)
+	r, session = c.get()
+	c.save(r, session)
+	pinned := now.Add(time.Minute).Truncate(time.Second)
+	if err := s.SetExpiry(context.Background(), session, pinned); err != nil {
+		t.Fatalf(`SetExpiry: %v`, err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf(`Close: %v`, err)
+	}
+	if _, expires, _ = s.Lookup(session.ID); !expires.Equal(pinned) {
+		t.Fatalf(`the flush moved the pinned expiry %v to %v`, pinned, expires)
+	}
+}